@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/brutella/smsremind/cal"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// AccountConfig configures an additional CalDav account in the config file.
+type AccountConfig struct {
+	// Name is prepended to the keys of the sent reminders,
+	// which keeps events with the same UID in different accounts apart.
+	Name             string `json:"name"`
+	CalDAV           string `json:"caldav"`
+	AppleID          string `json:"apple-id"`
+	ApplePassword    string `json:"apple-password"`
+	Calendars        string `json:"calendars"`
+	CalendarsExclude string `json:"calendars-exclude"`
+}
+
+// caldavAccount is a CalDav account of which the events are fetched.
+type caldavAccount struct {
+	Name             string
+	Server           *cal.CaldavURL
+	Calendars        []string
+	ExcludeCalendars []string
+}
+
+// String returns the name of the account or the host of its server.
+func (a caldavAccount) String() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	if a.Server.BaseURL != nil && a.Server.BaseURL.Host != "" {
+		return a.Server.BaseURL.Host
+	}
+	return "default"
+}
+
+// caldavAccounts returns the CalDav accounts of a run.
+// The first -caldav URL uses -apple-id, -apple-password and the calendar
+// filter flags. Further URLs must contain their credentials. The accounts
+// of the config file follow. The first account is omitted if it has no
+// credentials and the config file has accounts.
+func caldavAccounts(urls []string, configured []AccountConfig) ([]caldavAccount, error) {
+	var first string
+	if len(urls) > 0 {
+		first = urls[0]
+	}
+
+	server, err := caldavServer(first)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []caldavAccount
+	if hasCredentials(server) {
+		out = append(out, caldavAccount{
+			Server:           server,
+			Calendars:        parseCalendarNames(*calendars),
+			ExcludeCalendars: parseCalendarNames(*calendarsExclude),
+		})
+	} else if len(urls) > 0 || len(configured) == 0 {
+		return nil, errors.New("CALDAV_APPLEID or CALDAV_PASSWORD not specified")
+	}
+
+	for i := 1; i < len(urls); i++ {
+		server, err := cal.ParseCaldavURL(urls[i])
+		if err != nil {
+			return nil, fmt.Errorf("-caldav: %w", err)
+		}
+		server.Password = cal.NormalizeAppPassword(server.Password)
+		if !hasCredentials(server) {
+			return nil, fmt.Errorf("-caldav %s: missing credentials in the URL", server.BaseURL.Redacted())
+		}
+		out = append(out, caldavAccount{Server: server})
+	}
+
+	names := map[string]bool{}
+	for i, c := range configured {
+		name := strings.TrimSpace(c.Name)
+		if name != "" && names[name] {
+			return nil, fmt.Errorf("config accounts: duplicate name %q", name)
+		}
+		names[name] = true
+
+		server := &cal.CaldavURL{}
+		if c.CalDAV != "" {
+			if server, err = cal.ParseCaldavURL(c.CalDAV); err != nil {
+				return nil, fmt.Errorf("config account %d: %w", i+1, err)
+			}
+		}
+		if c.AppleID != "" {
+			server.AppleID = c.AppleID
+		}
+		if c.ApplePassword != "" {
+			server.Password = c.ApplePassword
+			server.HasPass = true
+		}
+		server.Password = cal.NormalizeAppPassword(server.Password)
+		if !hasCredentials(server) {
+			return nil, fmt.Errorf("config account %d: missing apple-id or apple-password", i+1)
+		}
+
+		out = append(out, caldavAccount{
+			Name:             name,
+			Server:           server,
+			Calendars:        parseCalendarNames(c.Calendars),
+			ExcludeCalendars: parseCalendarNames(c.CalendarsExclude),
+		})
+	}
+	return out, nil
+}
+
+func hasCredentials(server *cal.CaldavURL) bool {
+	return server.AppleID != "" && server.Password != ""
+}
+
+// accountQuery returns query for the account.
+func accountQuery(query Query, account caldavAccount) Query {
+	if account.Server.BaseURL != nil {
+		query.Endpoint = account.Server.BaseURL.String()
+	}
+	query.AppleId = account.Server.AppleID
+	query.Password = account.Server.Password
+	query.Calendars = account.Calendars
+	query.ExcludeCalendars = account.ExcludeCalendars
+	query.Account = account.Name
+	return query
+}
@@ -1,20 +1,34 @@
 package aspsms
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// DefaultBaseURL is the base URL of the ASPSMS WebAPI.
+const DefaultBaseURL = "https://webapi.aspsms.com"
+
 type Client struct {
 	userKey    string
 	password   string
 	originator string
+	baseURL    string
 	client     *http.Client
+	retry      RetryPolicy
+	sleep      func(context.Context, time.Duration) error
+	maxParts   int
+	flash      bool
+	post       bool
+	userAgent  string
 }
 
 func NewClient(userKey, password, originator string, timeout time.Duration) *Client {
@@ -22,23 +36,105 @@ func NewClient(userKey, password, originator string, timeout time.Duration) *Cli
 		userKey:    userKey,
 		password:   password,
 		originator: originator,
-		client:     &http.Client{Timeout: timeout},
+		baseURL:    DefaultBaseURL,
+		client:     &http.Client{Timeout: timeout, Transport: newTransport(http.ProxyFromEnvironment)},
+		sleep:      sleepContext,
 	}
 }
 
+// SetBaseURL sets the base URL of the WebAPI, e.g. of a test server
+// (DefaultBaseURL by default).
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = baseURL
+}
+
+// SetMaxParts makes the client reject messages which are split into
+// more than n SMS with a *LengthError (0 = no limit).
+func (c *Client) SetMaxParts(n int) {
+	c.maxParts = n
+}
+
 // SendSimpleSMS uses ASPSMS WebAPI endpoint GET /SendSimpleSMS.
 // Parameters (per ASPSMS connector docs): MSISDN, MessageData, Originator, optional LifeTime, DeferredDeliveryTime, TransactionReferenceNumber. :contentReference[oaicite:1]{index=1}
 //
 // We keep it minimal: MSISDN + MessageData + Originator.
 func (c *Client) SendSimpleTextSMS(recipientE164 string, text string) error {
+	_, err := c.send(context.Background(), recipientE164, text, "", time.Time{})
+	return err
+}
+
+// SendTextSMS sends a text message like SendSimpleTextSMS and returns the
+// TransactionReferenceNumber of the message, which can be used to query
+// its DeliveryStatus.
+func (c *Client) SendTextSMS(recipientE164 string, text string) (string, error) {
+	return c.SendTextSMSContext(context.Background(), recipientE164, text)
+}
+
+// SendTextSMSContext sends a text message like SendTextSMS. The request
+// and the delays between retries are aborted once ctx is done.
+func (c *Client) SendTextSMSContext(ctx context.Context, recipientE164 string, text string) (string, error) {
+	result, err := c.sendResult(ctx, recipientE164, text, time.Time{})
+	if err != nil {
+		return "", err
+	}
+	return result.TransactionRef, nil
+}
+
+// SendResult is the result of a sent message.
+type SendResult struct {
+	// TransactionRef is the TransactionReferenceNumber of the message.
+	TransactionRef string
+	// Credits as reported by ASPSMS (0 if not included in the response).
+	Credits float64
+	// Parts is the number of SMS the message was split into
+	// (as reported by ASPSMS, or computed with MessageInfo).
+	Parts int
+	// Code is the ASPSMS error code (1 == OK).
+	Code int
+}
+
+// SendTextSMSResult sends a text message like SendTextSMS and returns the
+// details of the ASPSMS response.
+func (c *Client) SendTextSMSResult(recipientE164 string, text string) (SendResult, error) {
+	return c.sendResult(context.Background(), recipientE164, text, time.Time{})
+}
+
+func (c *Client) sendResult(ctx context.Context, recipientE164 string, text string, deliverAt time.Time) (SendResult, error) {
+	ref := newReference()
+	resp, err := c.send(ctx, recipientE164, text, ref, deliverAt)
+	if err != nil {
+		return SendResult{}, err
+	}
+
+	parts := resp.Parts
+	if parts == 0 {
+		_, parts, _ = MessageInfo(text)
+	}
+
+	return SendResult{
+		TransactionRef: ref,
+		Credits:        resp.Credits,
+		Parts:          parts,
+		Code:           resp.Code,
+	}, nil
+}
+
+// send sends a message. The message is delivered immediately if deliverAt is zero.
+func (c *Client) send(ctx context.Context, recipientE164 string, text string, ref string, deliverAt time.Time) (response, error) {
 	if c.userKey == "" {
-		return fmt.Errorf("missing ASPSMS userkey")
+		return response{}, fmt.Errorf("missing ASPSMS userkey")
 	}
 	if c.password == "" {
-		return fmt.Errorf("missing ASPSMS password")
+		return response{}, fmt.Errorf("missing ASPSMS password")
 	}
 
-	endpoint := "https://webapi.aspsms.com/SendSimpleSMS"
+	if c.maxParts > 0 {
+		if enc, parts, _ := MessageInfo(text); parts > c.maxParts {
+			return response{}, &LengthError{Encoding: enc, Parts: parts, Max: c.maxParts}
+		}
+	}
+
+	endpoint := c.baseURL + sendEndpoint(text)
 
 	q := url.Values{}
 	q.Set("UserKey", c.userKey)
@@ -51,38 +147,157 @@ func (c *Client) SendSimpleTextSMS(recipientE164 string, text string) error {
 		q.Set("Originator", orig)
 	}
 
-	reqURL := endpoint + "?" + q.Encode()
-	resp, err := c.client.Get(reqURL)
+	if ref != "" {
+		q.Set("TransactionReferenceNumber", ref)
+	}
+
+	if !deliverAt.IsZero() {
+		q.Set("DeferredDeliveryTime", formatDeliveryTime(deliverAt))
+	}
+
+	if c.flash {
+		q.Set("FlashingSMS", "true")
+	}
+
+	r, err := c.request(ctx, endpoint, q)
+	for attempt := 1; err != nil && attempt < c.retry.MaxAttempts && isTransient(err); attempt++ {
+		if sleepErr := c.sleep(ctx, c.retry.delayAfter(err, attempt)); sleepErr != nil {
+			return r, errors.Join(err, sleepErr)
+		}
+		r, err = c.request(ctx, endpoint, q)
+	}
+	return r, err
+}
+
+// request sends the parameters q to endpoint and parses the response.
+func (c *Client) request(ctx context.Context, endpoint string, q url.Values) (response, error) {
+	return parseHTTPResponse(c.httpQuery(ctx, endpoint, q))
+}
+
+// sendEndpoint returns the WebAPI endpoint for text. SendSimpleSMS converts
+// the text to GSM 03.38, which replaces other characters (e.g. emoji or
+// Greek lower case letters). Such messages are sent with SendUnicodeSMS,
+// which delivers them as UCS-2. Both expect the text as URL-encoded UTF-8.
+func sendEndpoint(text string) string {
+	if enc, _, _ := MessageInfo(text); enc == UCS2 {
+		return "/SendUnicodeSMS"
+	}
+	return "/SendSimpleSMS"
+}
+
+// parseHTTPResponse parses the response of a single request.
+func parseHTTPResponse(resp *http.Response, err error) (response, error) {
 	if err != nil {
-		return err
+		return response{}, err
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return response{}, &HTTPError{
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(body)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
 	// The WebAPI commonly returns an ErrorCode integer (1 == OK).
-	if code, descr, ok := parseError(body); ok {
-		if code == 0 || code == 1 {
-			return nil
+	if r, ok := parseResponse(body); ok {
+		if r.Code == 0 || r.Code == 1 {
+			return r, nil
 		}
 		// ASPSMS documents error codes like "Invalid UserKey", "Invalid Password", etc. :contentReference[oaicite:2]{index=2}
-		return fmt.Errorf("aspsms error: %s (code: %d)", descr, code)
+		return response{}, &Error{Code: r.Code, Description: r.Description}
 	}
 
-	return fmt.Errorf("unexpected ASPSMS response: %s", strings.TrimSpace(string(body)))
+	return response{}, fmt.Errorf("unexpected ASPSMS response: %s", strings.TrimSpace(string(body)))
+}
+
+// response contains the common fields of ASPSMS WebAPI responses.
+type response struct {
+	Code        int
+	Description string
+
+	// Credits is only included in some responses (see HasCredits).
+	Credits    float64
+	HasCredits bool
+
+	Parts int
 }
 
-func parseError(body []byte) (int, string, bool) {
+// parseResponse parses a JSON response or the colon-delimited text
+// response of older WebAPI endpoints (e.g. "ErrorCode:1\nErrorDescription:ok").
+func parseResponse(body []byte) (response, bool) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] != '{' {
+		return parseTextResponse(string(body))
+	}
+
 	var obj struct {
-		ErrorCode        int    `json:"ErrorCode"`
-		ErrorDescription string `json:"ErrorDescription"`
+		ErrorCode        json.RawMessage `json:"ErrorCode"`
+		ErrorDescription string          `json:"ErrorDescription"`
+		Credits          json.RawMessage `json:"Credits"`
+		Parts            json.RawMessage `json:"Parts"`
+	}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return response{}, false
+	}
+
+	r := response{Description: obj.ErrorDescription}
+	if code, ok := parseNumber(obj.ErrorCode); ok {
+		r.Code = int(code)
+	} else if len(obj.ErrorCode) > 0 && string(obj.ErrorCode) != "null" {
+		return response{}, false
 	}
-	if err := json.Unmarshal(body, &obj); err == nil {
-		return obj.ErrorCode, obj.ErrorDescription, true
+	r.Credits, r.HasCredits = parseNumber(obj.Credits)
+	if parts, ok := parseNumber(obj.Parts); ok {
+		r.Parts = int(parts)
 	}
+	return r, true
+}
+
+// parseTextResponse parses a response of "Key:Value" lines.
+// The response must contain an ErrorCode.
+func parseTextResponse(body string) (response, bool) {
+	var r response
+	var hasCode bool
+	for _, line := range strings.Split(body, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
 
-	return 0, "", false
+		switch strings.TrimSpace(key) {
+		case "ErrorCode":
+			code, err := strconv.Atoi(value)
+			if err != nil {
+				return response{}, false
+			}
+			r.Code, hasCode = code, true
+		case "ErrorDescription":
+			r.Description = value
+		case "Credits":
+			r.Credits, r.HasCredits = parseNumber(json.RawMessage(value))
+		case "Parts":
+			if parts, ok := parseNumber(json.RawMessage(value)); ok {
+				r.Parts = int(parts)
+			}
+		}
+	}
+	return r, hasCode
+}
+
+// parseNumber parses a JSON number, which ASPSMS sometimes encodes as string.
+func parseNumber(raw json.RawMessage) (float64, bool) {
+	if len(raw) == 0 {
+		return 0, false
+	}
+
+	s := strings.TrimSpace(strings.Trim(string(raw), `"`))
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
 }
@@ -0,0 +1,97 @@
+package aspsms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server which responds with the error code
+// configured for the user key of a request.
+func newTestServer(t *testing.T, codes map[string]int) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := codes[r.URL.Query().Get("UserKey")]
+		fmt.Fprintf(w, `{"Credits":"10.00","ErrorCode":%d,"ErrorDescription":"code %d"}`, code, code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestClient(baseURL, userKey string) *Client {
+	c := NewClient(userKey, "password", "Test", time.Second)
+	c.baseURL = baseURL
+	return c
+}
+
+func TestSendTextSMSResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("TransactionReferenceNumber") == "" {
+			t.Error("missing TransactionReferenceNumber")
+		}
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK","Credits":"41.5","Parts":2}`)
+	}))
+	defer srv.Close()
+
+	result, err := newTestClient(srv.URL, "ok").SendTextSMSResult("+436604670967", "Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.TransactionRef == "" || result.Credits != 41.5 || result.Parts != 2 || result.Code != CodeOK {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := map[string]response{
+		`{"StatusCode":1,"StatusInfo":"OK","ErrorCode":1,"ErrorDescription":"OK"}`:  {Code: 1, Description: "OK"},
+		`{"ErrorCode":"9","ErrorDescription":"Invalid Password"}`:                   {Code: 9, Description: "Invalid Password"},
+		`{"Credits":"98.5","ErrorCode":1,"ErrorDescription":"OK","Parts":1}`:        {Code: 1, Description: "OK", Credits: 98.5, HasCredits: true, Parts: 1},
+		"ErrorCode:1\nErrorDescription:ok":                                          {Code: 1, Description: "ok"},
+		"ErrorCode:1\r\nErrorDescription:ok\r\n":                                    {Code: 1, Description: "ok"},
+		"ErrorCode: 8\nErrorDescription: Invalid UserKey":                           {Code: 8, Description: "Invalid UserKey"},
+		"Credits:12.50\nErrorCode:1\nErrorDescription:OK":                           {Code: 1, Description: "OK", Credits: 12.5, HasCredits: true},
+		"ErrorCode:1\nErrorDescription:Message: delivered to the provider\nParts:2": {Code: 1, Description: "Message: delivered to the provider", Parts: 2},
+	}
+
+	for in, want := range tests {
+		r, ok := parseResponse([]byte(in))
+		if !ok {
+			t.Fatalf("%q not parsed", in)
+		}
+		if r != want {
+			t.Fatalf("%q: %+v != %+v", in, r, want)
+		}
+	}
+
+	for _, in := range []string{"", "OK", "<html>Bad Gateway</html>", "ErrorDescription:ok", "ErrorCode:x", `{"ErrorCode":"x"}`} {
+		if _, ok := parseResponse([]byte(in)); ok {
+			t.Fatalf("%q must not be parsed", in)
+		}
+	}
+}
+
+func TestSendTextResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("UserKey") {
+		case "ok":
+			fmt.Fprint(w, "ErrorCode:1\nErrorDescription:ok")
+		default:
+			fmt.Fprint(w, "ErrorCode:8\nErrorDescription:Invalid UserKey")
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := newTestClient(srv.URL, "ok").SendTextSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := newTestClient(srv.URL, "invalid").SendTextSMS("+436604670967", "Hello")
+	if apiErr, ok := err.(*Error); !ok || apiErr.Code != CodeInvalidUserKey {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
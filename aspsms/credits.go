@@ -0,0 +1,49 @@
+package aspsms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Credits returns the credit balance of the account.
+// It uses the ASPSMS WebAPI endpoint /CheckCredits.
+func (c *Client) Credits() (float64, error) {
+	if c.userKey == "" {
+		return 0, fmt.Errorf("missing ASPSMS userkey")
+	}
+	if c.password == "" {
+		return 0, fmt.Errorf("missing ASPSMS password")
+	}
+
+	q := url.Values{}
+	q.Set("UserKey", c.userKey)
+	q.Set("Password", c.password)
+
+	resp, err := c.httpQuery(context.Background(), c.baseURL+"/CheckCredits", q)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	r, ok := parseResponse(body)
+	if !ok {
+		return 0, fmt.Errorf("unexpected ASPSMS response: %s", strings.TrimSpace(string(body)))
+	}
+
+	if r.Code != 0 && r.Code != CodeOK {
+		return 0, &Error{Code: r.Code, Description: r.Description}
+	}
+
+	if !r.HasCredits {
+		return 0, fmt.Errorf("unexpected ASPSMS response: %s", strings.TrimSpace(string(body)))
+	}
+	return r.Credits, nil
+}
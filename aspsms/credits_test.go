@@ -0,0 +1,24 @@
+package aspsms
+
+import "testing"
+
+func TestParseCredits(t *testing.T) {
+	tests := map[string]float64{
+		`{"Credits":"123.45","ErrorCode":1,"ErrorDescription":"OK"}`: 123.45,
+		`{"Credits":17,"ErrorCode":1}`:                               17,
+	}
+
+	for in, want := range tests {
+		r, ok := parseResponse([]byte(in))
+		if !ok || !r.HasCredits {
+			t.Fatalf("credits expected for %s", in)
+		}
+		if is := r.Credits; is != want {
+			t.Fatalf("%v != %v", is, want)
+		}
+	}
+
+	if r, _ := parseResponse([]byte(`{"ErrorCode":1}`)); r.HasCredits {
+		t.Fatal("no credits expected")
+	}
+}
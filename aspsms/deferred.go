@@ -0,0 +1,35 @@
+package aspsms
+
+import (
+	"context"
+	"time"
+)
+
+// deliveryTimeLayout is the ASPSMS format of DeferredDeliveryTime (ddmmyyyyhhmmss, UTC).
+const deliveryTimeLayout = "02012006150405"
+
+// SendDeferredSMS sends a text message which ASPSMS delivers at deliverAt.
+func (c *Client) SendDeferredSMS(recipientE164 string, text string, deliverAt time.Time) error {
+	_, err := c.send(context.Background(), recipientE164, text, "", deliverAt)
+	return err
+}
+
+// SendDeferredTextSMS sends a text message like SendDeferredSMS and returns the
+// TransactionReferenceNumber of the message.
+func (c *Client) SendDeferredTextSMS(recipientE164 string, text string, deliverAt time.Time) (string, error) {
+	return c.SendDeferredTextSMSContext(context.Background(), recipientE164, text, deliverAt)
+}
+
+// SendDeferredTextSMSContext sends a text message like SendDeferredTextSMS.
+// The request and the delays between retries are aborted once ctx is done.
+func (c *Client) SendDeferredTextSMSContext(ctx context.Context, recipientE164 string, text string, deliverAt time.Time) (string, error) {
+	result, err := c.sendResult(ctx, recipientE164, text, deliverAt)
+	if err != nil {
+		return "", err
+	}
+	return result.TransactionRef, nil
+}
+
+func formatDeliveryTime(t time.Time) string {
+	return t.UTC().Format(deliveryTimeLayout)
+}
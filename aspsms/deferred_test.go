@@ -0,0 +1,28 @@
+package aspsms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendDeferredSMS(t *testing.T) {
+	var deferred string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deferred = r.URL.Query().Get("DeferredDeliveryTime")
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	loc, _ := time.LoadLocation("Europe/Vienna")
+	at := time.Date(2025, 1, 10, 9, 0, 0, 0, loc)
+	if err := newTestClient(srv.URL, "ok").SendDeferredSMS("+436604670967", "Hello", at); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := deferred, "10012025080000"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+}
@@ -0,0 +1,89 @@
+package aspsms
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ASPSMS error codes
+const (
+	CodeOK                  = 1
+	CodeConnectFailed       = 2
+	CodeAuthorizationFailed = 3
+	CodeNotEnoughCredits    = 5
+	CodeTimeout             = 6
+	CodeTransmissionError   = 7
+	CodeInvalidUserKey      = 8
+	CodeInvalidPassword     = 9
+	CodeInvalidOriginator   = 10
+	CodeInvalidMessageData  = 11
+	CodeMissingRecipient    = 20
+	CodeInvalidRecipient    = 24
+)
+
+// Error is an error reported by the ASPSMS API.
+type Error struct {
+	Code        int
+	Description string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("aspsms error: %s (code: %d)", e.Description, e.Code)
+}
+
+// HTTPError is returned when the ASPSMS API responds with a non-2xx status code.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay requested by the Retry-After header (0 if absent).
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http %d: %s", e.StatusCode, e.Body)
+}
+
+// IsRateLimited returns true if err is caused by rate limiting (HTTP 429).
+func IsRateLimited(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests
+}
+
+// IsAccountError returns true if err is caused by the account or the
+// availability of the service rather than by the message itself.
+// Sending the same message with another account may succeed.
+func IsAccountError(err error) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case CodeConnectFailed, CodeAuthorizationFailed, CodeNotEnoughCredits,
+			CodeTimeout, CodeTransmissionError, CodeInvalidUserKey, CodeInvalidPassword:
+			return true
+		}
+		return false
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch {
+		case httpErr.StatusCode >= 500:
+			return true
+		case httpErr.StatusCode == http.StatusUnauthorized,
+			httpErr.StatusCode == http.StatusForbidden,
+			httpErr.StatusCode == http.StatusTooManyRequests:
+			return true
+		}
+		return false
+	}
+
+	// Another account would reject the message as well
+	var lengthErr *LengthError
+	if errors.As(err, &lengthErr) {
+		return false
+	}
+
+	// Network errors, missing credentials, unexpected responses
+	return true
+}
@@ -0,0 +1,33 @@
+package aspsms
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Failover is a list of clients for different ASPSMS accounts.
+// The first client is the primary account, the others are backups.
+type Failover []*Client
+
+// Do calls fn with the clients in order until fn succeeds.
+// The next client is only tried if the error is an account error
+// (see IsAccountError). Do returns the index of the client which succeeded.
+func (f Failover) Do(fn func(*Client) error) (int, error) {
+	if len(f) == 0 {
+		return -1, errors.New("no ASPSMS account configured")
+	}
+
+	var errs []error
+	for i, c := range f {
+		err := fn(c)
+		if err == nil {
+			return i, nil
+		}
+
+		errs = append(errs, fmt.Errorf("account %d: %w", i+1, err))
+		if !IsAccountError(err) {
+			break
+		}
+	}
+	return -1, errors.Join(errs...)
+}
@@ -0,0 +1,36 @@
+package aspsms
+
+import "testing"
+
+func TestFailover(t *testing.T) {
+	srv := newTestServer(t, map[string]int{
+		"empty":   CodeNotEnoughCredits,
+		"ok":      CodeOK,
+		"invalid": CodeInvalidRecipient,
+	})
+
+	accounts := Failover{newTestClient(srv.URL, "empty"), newTestClient(srv.URL, "ok")}
+	i, err := accounts.Do(func(c *Client) error {
+		return c.SendSimpleTextSMS("+436604670967", "Hello")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != 1 {
+		t.Fatalf("sent with account %d, want 1", i)
+	}
+
+	// Errors caused by the message must not be retried with another account.
+	var tried []string
+	accounts = Failover{newTestClient(srv.URL, "invalid"), newTestClient(srv.URL, "ok")}
+	_, err = accounts.Do(func(c *Client) error {
+		tried = append(tried, c.userKey)
+		return c.SendSimpleTextSMS("+436604670967", "Hello")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(tried) != 1 {
+		t.Fatalf("tried accounts %v, want only the first", tried)
+	}
+}
@@ -0,0 +1,20 @@
+package aspsms
+
+import (
+	"context"
+	"time"
+)
+
+// SetFlash makes the client send all messages as flash SMS (class 0).
+func (c *Client) SetFlash(flash bool) {
+	c.flash = flash
+}
+
+// SendFlashSMS sends a text message as flash SMS (class 0), which is
+// displayed immediately instead of being stored in the inbox.
+func (c *Client) SendFlashSMS(recipientE164 string, text string) error {
+	flash := *c
+	flash.flash = true
+	_, err := flash.send(context.Background(), recipientE164, text, "", time.Time{})
+	return err
+}
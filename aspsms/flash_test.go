@@ -0,0 +1,34 @@
+package aspsms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendFlashSMS(t *testing.T) {
+	var flash []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flash = append(flash, r.URL.Query().Get("FlashingSMS"))
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL, "ok")
+	if err := c.SendFlashSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendSimpleTextSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetFlash(true)
+	if _, err := c.SendTextSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := fmt.Sprint(flash), "[true  true]"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+}
@@ -0,0 +1,72 @@
+package aspsms
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Encoding is the character encoding of a SMS.
+type Encoding int
+
+const (
+	// GSM7 is the GSM 03.38 7-bit default alphabet (160 characters per SMS).
+	GSM7 Encoding = iota
+	// UCS2 is used for messages with characters outside of GSM7 (70 characters per SMS).
+	UCS2
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case GSM7:
+		return "GSM-7"
+	case UCS2:
+		return "UCS-2"
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// Characters of the GSM 03.38 default alphabet and its extension table.
+// Extension characters are sent as an escape sequence and count twice.
+const (
+	gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "\f^{}\\[~]|€"
+)
+
+// MessageInfo returns the encoding of text, the number of SMS it is split into
+// and its length in characters of the encoding (septets for GSM7, UTF-16 code units for UCS2).
+func MessageInfo(text string) (encoding Encoding, parts int, chars int) {
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			chars++
+		case strings.ContainsRune(gsm7Extension, r):
+			chars += 2
+		default:
+			chars = len(utf16.Encode([]rune(text)))
+			return UCS2, messageParts(chars, 70, 67), chars
+		}
+	}
+	return GSM7, messageParts(chars, 160, 153), chars
+}
+
+// messageParts returns the number of SMS for a message with chars characters.
+// Concatenated messages have less space per part because of the user data header.
+func messageParts(chars, single, multi int) int {
+	if chars <= single {
+		return 1
+	}
+	return (chars + multi - 1) / multi
+}
+
+// LengthError is returned if a message needs more SMS than allowed.
+type LengthError struct {
+	Encoding Encoding
+	Parts    int
+	Max      int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("message needs %d %s SMS (max %d)", e.Parts, e.Encoding, e.Max)
+}
@@ -0,0 +1,52 @@
+package aspsms
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageInfo(t *testing.T) {
+	tests := []struct {
+		text     string
+		encoding Encoding
+		parts    int
+		chars    int
+	}{
+		{"Hello", GSM7, 1, 5},
+		{"Grüße aus Österreich", GSM7, 1, 20},
+		{"Preis: 10€", GSM7, 1, 11},
+		{strings.Repeat("a", 160), GSM7, 1, 160},
+		{strings.Repeat("a", 161), GSM7, 2, 161},
+		{strings.Repeat("a", 306), GSM7, 2, 306},
+		{strings.Repeat("a", 307), GSM7, 3, 307},
+		{"Zeit: 9:30 ✓", UCS2, 1, 12},
+		{strings.Repeat("ê", 70), UCS2, 1, 70},
+		{strings.Repeat("ê", 71), UCS2, 2, 71},
+		{"👋", UCS2, 1, 2},
+	}
+
+	for _, test := range tests {
+		enc, parts, chars := MessageInfo(test.text)
+		if enc != test.encoding || parts != test.parts || chars != test.chars {
+			t.Fatalf("%q: %s %d %d, want %s %d %d", test.text, enc, parts, chars, test.encoding, test.parts, test.chars)
+		}
+	}
+}
+
+func TestMaxParts(t *testing.T) {
+	c := NewClient("key", "password", "Test", time.Second)
+	c.baseURL = "http://127.0.0.1:0"
+	c.SetMaxParts(1)
+
+	err := c.SendSimpleTextSMS("+436604670967", strings.Repeat("ê", 71))
+	var lengthErr *LengthError
+	if !errors.As(err, &lengthErr) {
+		t.Fatalf("expected LengthError, got %v", err)
+	}
+
+	if IsAccountError(err) {
+		t.Fatal("length errors must not fail over to another account")
+	}
+}
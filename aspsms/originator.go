@@ -0,0 +1,62 @@
+package aspsms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxAlphanumericOriginator is the maximum length of an alphanumeric originator.
+const maxAlphanumericOriginator = 11
+
+// ValidateOriginator returns an error if ASPSMS would reject the originator.
+// Alphanumeric originators are limited to 11 ASCII characters,
+// numeric originators must be phone numbers with up to 15 digits.
+func ValidateOriginator(originator string) error {
+	s := strings.TrimSpace(originator)
+	if s == "" {
+		return errors.New("empty originator")
+	}
+
+	if isNumeric(s) {
+		if digits := strings.TrimPrefix(s, "+"); len(digits) > 15 {
+			return fmt.Errorf("invalid originator %q: more than 15 digits", originator)
+		}
+		return nil
+	}
+
+	if len(s) > maxAlphanumericOriginator {
+		return fmt.Errorf("invalid originator %q: more than %d characters", originator, maxAlphanumericOriginator)
+	}
+	for _, r := range s {
+		if r < ' ' || r > '~' {
+			return fmt.Errorf("invalid originator %q: unsupported character %q", originator, r)
+		}
+	}
+	return nil
+}
+
+// WithOriginator returns a copy of the client which sends messages from originator.
+func (c *Client) WithOriginator(originator string) (*Client, error) {
+	if err := ValidateOriginator(originator); err != nil {
+		return nil, err
+	}
+
+	from := *c
+	from.originator = originator
+	return &from, nil
+}
+
+// SendSimpleTextSMSFrom sends a text message like SendSimpleTextSMS
+// with originator instead of the originator of the client.
+func (c *Client) SendSimpleTextSMSFrom(originator, recipientE164 string, text string) error {
+	from, err := c.WithOriginator(originator)
+	if err != nil {
+		return err
+	}
+
+	_, err = from.send(context.Background(), recipientE164, text, "", time.Time{})
+	return err
+}
@@ -0,0 +1,52 @@
+package aspsms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateOriginator(t *testing.T) {
+	tests := map[string]bool{
+		"DentalClinic":      false, // 12 characters
+		"PhysioClinic":      false,
+		"Physio":            true,
+		"Dr. Müller":        false,
+		"+436604670967":     true,
+		"1234567890123456":  false,
+		"":                  false,
+		"Praxis Dr.K":       true,
+		"+4366046709671234": false,
+	}
+
+	for originator, valid := range tests {
+		if err := ValidateOriginator(originator); (err == nil) != valid {
+			t.Fatalf("%q: %v", originator, err)
+		}
+	}
+}
+
+func TestSendSimpleTextSMSFrom(t *testing.T) {
+	var originators []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		originators = append(originators, r.URL.Query().Get("Originator"))
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL, "ok")
+	if err := c.SendSimpleTextSMSFrom("Physio", "+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendSimpleTextSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendSimpleTextSMSFrom("DentalClinic", "+436604670967", "Hello"); err == nil {
+		t.Fatal("expected error for invalid originator")
+	}
+
+	if is, want := fmt.Sprint(originators), "[Physio Test]"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+}
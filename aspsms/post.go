@@ -0,0 +1,11 @@
+package aspsms
+
+// SetPost makes the client send all requests (messages, Credits,
+// DeliveryStatus and the check of numeric originators) with POST requests,
+// which carry the parameters in a form-encoded body instead of the URL.
+// This keeps the message text and the credentials out of the logs of
+// proxies and servers, and long messages aren't limited by the maximum
+// URL length.
+func (c *Client) SetPost(post bool) {
+	c.post = post
+}
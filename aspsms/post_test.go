@@ -0,0 +1,61 @@
+package aspsms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendWithPost(t *testing.T) {
+	var method, query, text string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, query = r.Method, r.URL.RawQuery
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		text = r.PostForm.Get("MessageData")
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL, "key")
+	c.SetPost(true)
+
+	msg := strings.Repeat("Your next appointment is tomorrow. ", 10)
+	if err := c.SendSimpleTextSMS("+436604670967", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPost || query != "" {
+		t.Fatalf("unexpected request %s ?%s", method, query)
+	}
+	if text != msg {
+		t.Fatalf("%q != %q", text, msg)
+	}
+}
+
+func TestCreditsWithPost(t *testing.T) {
+	var method, query, password string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, query = r.Method, r.URL.RawQuery
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		password = r.PostForm.Get("Password")
+		fmt.Fprint(w, `{"Credits":"12.5","ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL, "key")
+	c.SetPost(true)
+
+	if _, err := c.Credits(); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPost || query != "" || password != "password" {
+		t.Fatalf("unexpected request %s ?%s", method, query)
+	}
+}
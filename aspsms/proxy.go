@@ -0,0 +1,23 @@
+package aspsms
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// SetProxy sets the function which returns the proxy for a request.
+// Nil uses the proxy configured by the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables, which is the default.
+func (c *Client) SetProxy(proxy func(*http.Request) (*url.URL, error)) {
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	c.client.Transport = newTransport(proxy)
+}
+
+// newTransport returns a copy of the default transport which uses proxy.
+func newTransport(proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxy
+	return t
+}
@@ -0,0 +1,36 @@
+package aspsms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestProxy(t *testing.T) {
+	var host string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient("key", "password", "Test", time.Second)
+	c.baseURL = "http://webapi.aspsms.invalid"
+	c.SetProxy(http.ProxyURL(proxyURL))
+
+	if err := c.SendSimpleTextSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if host != "webapi.aspsms.invalid" {
+		t.Fatalf("request to %q not sent through the proxy", host)
+	}
+}
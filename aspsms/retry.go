@@ -0,0 +1,100 @@
+package aspsms
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy defines how often a failed request is retried.
+// Only transient failures (network errors, HTTP 5xx and 429) are retried;
+// errors reported by the API (e.g. an invalid user key) are permanent.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts; values < 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every further retry.
+	BaseDelay time.Duration
+	// MaxRetryAfter caps the delay requested by a Retry-After header
+	// of a rate limited request (default 1 minute).
+	MaxRetryAfter time.Duration
+}
+
+// defaultMaxRetryAfter is used if RetryPolicy.MaxRetryAfter is 0.
+const defaultMaxRetryAfter = time.Minute
+
+// NewClientWithRetry returns a client which retries transient failures according to policy.
+// Every attempt is bounded by timeout.
+func NewClientWithRetry(userKey, password, originator string, timeout time.Duration, policy RetryPolicy) *Client {
+	c := NewClient(userKey, password, originator, timeout)
+	c.retry = policy
+	return c
+}
+
+// delay returns the backoff before the given retry (1 = first retry).
+func (p RetryPolicy) delay(retry int) time.Duration {
+	return p.BaseDelay << (retry - 1)
+}
+
+// delayAfter returns the backoff before the given retry of a request which failed with err.
+// The Retry-After of a rate limited request takes precedence.
+func (p RetryPolicy) delayAfter(err error, retry int) time.Duration {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+		limit := p.MaxRetryAfter
+		if limit == 0 {
+			limit = defaultMaxRetryAfter
+		}
+		return min(httpErr.RetryAfter, limit)
+	}
+	return p.delay(retry)
+}
+
+// parseRetryAfter parses the value of a Retry-After header,
+// which is either a number of seconds or an HTTP date.
+// It returns 0 for an empty or invalid value.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isTransient returns true if a request which failed with err may succeed when retried.
+func isTransient(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500 || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
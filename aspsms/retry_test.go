@@ -0,0 +1,178 @@
+package aspsms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientFailures(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	var delays []time.Duration
+	c := NewClientWithRetry("key", "password", "Test", time.Second, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second})
+	c.baseURL = srv.URL
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	if err := c.SendSimpleTextSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 3 {
+		t.Fatalf("%d requests, expected 3", requests)
+	}
+
+	if len(delays) != 2 || delays[0] != time.Second || delays[1] != 2*time.Second {
+		t.Fatalf("unexpected delays %v", delays)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c := NewClientWithRetry("key", "password", "Test", time.Second, RetryPolicy{MaxAttempts: 2})
+	c.baseURL = srv.URL
+	c.sleep = func(context.Context, time.Duration) error { return nil }
+
+	if err := c.SendSimpleTextSMS("+436604670967", "Hello"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if requests != 2 {
+		t.Fatalf("%d requests, expected 2", requests)
+	}
+}
+
+func TestNoRetryOnAPIError(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `{"ErrorCode":%d,"ErrorDescription":"Invalid UserKey"}`, CodeInvalidUserKey)
+	}))
+	defer srv.Close()
+
+	c := NewClientWithRetry("key", "password", "Test", time.Second, RetryPolicy{MaxAttempts: 3})
+	c.baseURL = srv.URL
+	c.sleep = func(context.Context, time.Duration) error { return nil }
+
+	if err := c.SendSimpleTextSMS("+436604670967", "Hello"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if requests != 1 {
+		t.Fatalf("%d requests, expected 1", requests)
+	}
+}
+
+func TestRetryAfterRateLimit(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if requests == 2 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	var delays []time.Duration
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxRetryAfter: 10 * time.Second}
+	c := NewClientWithRetry("key", "password", "Test", time.Second, policy)
+	c.baseURL = srv.URL
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	if err := c.SendSimpleTextSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second Retry-After is capped
+	if len(delays) != 2 || delays[0] != 5*time.Second || delays[1] != 10*time.Second {
+		t.Fatalf("unexpected delays %v", delays)
+	}
+}
+
+func TestRateLimitedWithoutRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	err := newTestClient(srv.URL, "key").SendSimpleTextSMS("+436604670967", "Hello")
+	if !IsRateLimited(err) {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"soon":                          0,
+		"Fri, 10 Jan 2025 09:00:30 GMT": 30 * time.Second,
+		"Fri, 10 Jan 2025 08:00:00 GMT": 0,
+	}
+
+	for in, want := range tests {
+		if is := parseRetryAfter(in, now); is != want {
+			t.Fatalf("%q: %s != %s", in, is, want)
+		}
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// The default sleep waits a minute unless the context is done.
+	c := NewClientWithRetry("key", "password", "Test", time.Second, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute})
+	c.baseURL = srv.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.SendTextSMSContext(ctx, "+436604670967", "Hello")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if requests != 1 || time.Since(start) > 10*time.Second {
+		t.Fatalf("%d requests in %v", requests, time.Since(start))
+	}
+}
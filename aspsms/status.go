@@ -0,0 +1,148 @@
+package aspsms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// State is the delivery state of a message.
+type State int
+
+const (
+	StateUnknown State = iota
+	StateQueued
+	StateDelivered
+	StateFailed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateQueued:
+		return "queued"
+	case StateDelivered:
+		return "delivered"
+	case StateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Status is the delivery status of a message.
+type Status struct {
+	State State
+	// Time of the last delivery notification (zero if unknown).
+	Time time.Time
+	// Description as reported by ASPSMS.
+	Description string
+}
+
+// DeliveryStatus returns the delivery status of the message with the
+// TransactionReferenceNumber ref. It uses the ASPSMS WebAPI endpoint
+// /InquireDeliveryNotifications.
+func (c *Client) DeliveryStatus(ref string) (Status, error) {
+	if c.userKey == "" {
+		return Status{}, fmt.Errorf("missing ASPSMS userkey")
+	}
+	if c.password == "" {
+		return Status{}, fmt.Errorf("missing ASPSMS password")
+	}
+
+	q := url.Values{}
+	q.Set("UserKey", c.userKey)
+	q.Set("Password", c.password)
+	q.Set("TransactionReferenceNumbers", ref)
+
+	resp, err := c.httpQuery(context.Background(), c.baseURL+"/InquireDeliveryNotifications", q)
+	if err != nil {
+		return Status{}, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Status{}, &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	if r, ok := parseResponse(body); ok && r.Code != 0 && r.Code != CodeOK {
+		return Status{}, &Error{Code: r.Code, Description: r.Description}
+	}
+
+	return parseDeliveryStatus(body, ref)
+}
+
+func parseDeliveryStatus(body []byte, ref string) (Status, error) {
+	var obj struct {
+		DeliveryNotifications []struct {
+			TransactionReferenceNumber string          `json:"TransactionReferenceNumber"`
+			DeliveryStatus             json.RawMessage `json:"DeliveryStatus"`
+			DeliveryStatusDescription  string          `json:"DeliveryStatusDescription"`
+			NotificationDate           string          `json:"NotificationDate"`
+		} `json:"DeliveryNotifications"`
+	}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return Status{}, fmt.Errorf("unexpected ASPSMS response: %s", strings.TrimSpace(string(body)))
+	}
+
+	for _, n := range obj.DeliveryNotifications {
+		if n.TransactionReferenceNumber != ref {
+			continue
+		}
+
+		code, err := strconv.Atoi(strings.Trim(string(n.DeliveryStatus), `" `))
+		if err != nil {
+			return Status{}, fmt.Errorf("invalid delivery status %s", n.DeliveryStatus)
+		}
+
+		return Status{
+			State:       deliveryState(code),
+			Time:        parseNotificationDate(n.NotificationDate),
+			Description: n.DeliveryStatusDescription,
+		}, nil
+	}
+
+	// No notification yet
+	return Status{State: StateUnknown}, nil
+}
+
+// deliveryState maps ASPSMS delivery status codes to a State.
+//
+//	-1: not yet submitted or rejected
+//	 0: delivered
+//	 1: buffered
+//	 2: not delivered
+func deliveryState(code int) State {
+	switch code {
+	case -1, 1:
+		return StateQueued
+	case 0:
+		return StateDelivered
+	case 2:
+		return StateFailed
+	}
+	return StateUnknown
+}
+
+func parseNotificationDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"02012006150405", time.RFC3339, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// newReference returns a random TransactionReferenceNumber.
+func newReference() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
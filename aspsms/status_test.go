@@ -0,0 +1,36 @@
+package aspsms
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeliveryStatus(t *testing.T) {
+	body := []byte(`{"DeliveryNotifications":[
+		{"TransactionReferenceNumber":"a1","DeliveryStatus":"0","DeliveryStatusDescription":"Delivered","NotificationDate":"10012025091500"},
+		{"TransactionReferenceNumber":"b2","DeliveryStatus":"2","DeliveryStatusDescription":"Not delivered","NotificationDate":"10012025091600"},
+		{"TransactionReferenceNumber":"c3","DeliveryStatus":1}
+	],"ErrorCode":1,"ErrorDescription":"OK"}`)
+
+	tests := map[string]State{
+		"a1": StateDelivered,
+		"b2": StateFailed,
+		"c3": StateQueued,
+		"d4": StateUnknown,
+	}
+
+	for ref, want := range tests {
+		status, err := parseDeliveryStatus(body, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if is := status.State; is != want {
+			t.Fatalf("%s: %s != %s", ref, is, want)
+		}
+	}
+
+	status, _ := parseDeliveryStatus(body, "a1")
+	if is, want := status.Time, time.Date(2025, 1, 10, 9, 15, 0, 0, time.UTC); !is.Equal(want) {
+		t.Fatalf("%s != %s", is, want)
+	}
+}
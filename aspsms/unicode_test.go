@@ -0,0 +1,41 @@
+package aspsms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendUnicodeSMS(t *testing.T) {
+	var paths, texts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		texts = append(texts, r.URL.Query().Get("MessageData"))
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	tests := map[string]string{
+		"Termin morgen um 09:30":   "/SendSimpleSMS",
+		"Grüße, Zoë! Ihr Termin":   "/SendUnicodeSMS",
+		"Café à 9h, señor":         "/SendSimpleSMS",
+		"Ραντεβού αύριο":           "/SendUnicodeSMS",
+		"Bis morgen 😀":             "/SendUnicodeSMS",
+		"Preis: 20€ {inkl. MwSt.}": "/SendSimpleSMS",
+	}
+
+	c := newTestClient(srv.URL, "ok")
+	for text, endpoint := range tests {
+		paths, texts = nil, nil
+		if err := c.SendSimpleTextSMS("+436604670967", text); err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != 1 || paths[0] != endpoint {
+			t.Fatalf("%q: %v != %s", text, paths, endpoint)
+		}
+		if texts[0] != text {
+			t.Fatalf("%q != %q", texts[0], text)
+		}
+	}
+}
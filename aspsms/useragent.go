@@ -0,0 +1,49 @@
+package aspsms
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SetUserAgent sets the User-Agent header of the requests,
+// e.g. "smsremind/1.2.0". Empty uses the default of net/http.
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+}
+
+// httpGet sends a GET request to reqURL.
+func (c *Client) httpGet(ctx context.Context, reqURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// httpQuery sends the parameters q to endpoint in the URL,
+// or with SetPost in the body of a POST request.
+func (c *Client) httpQuery(ctx context.Context, endpoint string, q url.Values) (*http.Response, error) {
+	if c.post {
+		return c.httpPostForm(ctx, endpoint, q)
+	}
+	return c.httpGet(ctx, endpoint+"?"+q.Encode())
+}
+
+// httpPostForm sends q form-encoded in the body of a POST request to endpoint.
+func (c *Client) httpPostForm(ctx context.Context, endpoint string, q url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(q.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req)
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	return c.client.Do(req)
+}
@@ -0,0 +1,39 @@
+package aspsms
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserAgent(t *testing.T) {
+	var agents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		fmt.Fprint(w, `{"Credits":"1","ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL, "key")
+	c.SetUserAgent("smsremind/1.0")
+	if err := c.SendSimpleTextSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	c.SetPost(true)
+	if err := c.SendSimpleTextSMS("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Credits(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ua := range agents {
+		if ua != "smsremind/1.0" {
+			t.Fatalf("unexpected User-Agent %q", ua)
+		}
+	}
+	if len(agents) != 3 {
+		t.Fatalf("%d requests", len(agents))
+	}
+}
@@ -0,0 +1,83 @@
+package aspsms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Validate checks that a message could be sent without sending it.
+// ASPSMS has no test mode for SendSimpleSMS, so the request is validated
+// in parts: the credentials via CheckCredits, a numeric originator via
+// CheckOriginatorAuthorization and the recipient and text locally.
+// No credits are spent.
+func (c *Client) Validate(recipientE164 string, text string) error {
+	if err := validateRecipient(recipientE164); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return errors.New("empty message")
+	}
+
+	if _, err := c.Credits(); err != nil {
+		return err
+	}
+
+	orig := strings.TrimSpace(c.originator)
+	if orig == "" || !isNumeric(orig) {
+		// Alphanumeric originators don't need to be authorized.
+		return nil
+	}
+
+	return c.checkOriginatorAuthorization(orig)
+}
+
+func (c *Client) checkOriginatorAuthorization(originator string) error {
+	q := url.Values{}
+	q.Set("UserKey", c.userKey)
+	q.Set("Password", c.password)
+	q.Set("Originator", originator)
+
+	resp, err := c.httpQuery(context.Background(), c.baseURL+"/CheckOriginatorAuthorization", q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	if r, ok := parseResponse(body); ok {
+		if r.Code == 0 || r.Code == CodeOK {
+			return nil
+		}
+		return &Error{Code: r.Code, Description: r.Description}
+	}
+
+	return fmt.Errorf("unexpected ASPSMS response: %s", strings.TrimSpace(string(body)))
+}
+
+// validateRecipient returns an error if s is not a number in E.164 format.
+func validateRecipient(s string) error {
+	digits := strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "+") || len(digits) < 7 || len(digits) > 15 || !isNumeric(digits) {
+		return fmt.Errorf("invalid recipient %q (want E.164)", s)
+	}
+	return nil
+}
+
+func isNumeric(s string) bool {
+	for _, r := range strings.TrimPrefix(s, "+") {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package aspsms
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	srv := newTestServer(t, map[string]int{"ok": CodeOK, "invalid": CodeInvalidUserKey})
+
+	c := newTestClient(srv.URL, "ok")
+	if err := c.Validate("+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, num := range []string{"06604670967", "+43 660 4670967", "+43"} {
+		if err := c.Validate(num, "Hello"); err == nil {
+			t.Fatalf("expected error for %q", num)
+		}
+	}
+
+	if err := c.Validate("+436604670967", " "); err == nil {
+		t.Fatal("expected error for empty message")
+	}
+
+	c = newTestClient(srv.URL, "invalid")
+	if err := c.Validate("+436604670967", "Hello"); err == nil {
+		t.Fatal("expected error for invalid credentials")
+	}
+}
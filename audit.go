@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// auditRecord is a line in the audit log.
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	Key         string    `json:"key"`
+	Recipient   string    `json:"recipient"`
+	Message     string    `json:"message,omitempty"`
+	MessageHash string    `json:"message_sha256"`
+	Account     int       `json:"account"`
+	Reference   string    `json:"reference,omitempty"`
+	Calendar    string    `json:"calendar,omitempty"`
+}
+
+// newAuditRecord returns the audit record of a sent reminder.
+// Unless full is true, the recipient is masked and the message is
+// only recorded as hash.
+func newAuditRecord(key, recipient, msg string, account int, ref string, full bool) auditRecord {
+	sum := sha256.Sum256([]byte(msg))
+	r := auditRecord{
+		Time:        time.Now().UTC(),
+		Key:         key,
+		Recipient:   recipient,
+		MessageHash: hex.EncodeToString(sum[:]),
+		Account:     account + 1,
+		Reference:   ref,
+	}
+
+	if full {
+		r.Message = msg
+	} else {
+		r.Recipient = maskNumber(recipient)
+	}
+	return r
+}
+
+// maskNumber replaces all but the first 3 and the last 3 characters with *.
+func maskNumber(num string) string {
+	if len(num) <= 6 {
+		return strings.Repeat("*", len(num))
+	}
+	return num[:3] + strings.Repeat("*", len(num)-6) + num[len(num)-3:]
+}
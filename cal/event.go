@@ -10,9 +10,65 @@ type Event struct {
 	UID         string
 	Start       time.Time
 	End         time.Time
+	AllDay      bool // Start and End are dates (VALUE=DATE)
 	Summary     string
 	Description string
 	Comment     string
+	Location    string
+
+	// RecurrenceID is the original start of an overridden occurrence
+	// of a recurring event (RECURRENCE-ID), zero otherwise.
+	RecurrenceID time.Time
+
+	// Status is the STATUS of the event in upper case, e.g. CONFIRMED, TENTATIVE or CANCELLED.
+	Status string
+
+	// Organizer is the name (or the address) of the ORGANIZER, e.g. the practitioner.
+	Organizer string
+
+	// Attendees contains the values of the ATTENDEE properties (usually mailto: or tel: URIs).
+	Attendees []string
+
+	// PartStat contains the participation status (PARTSTAT) of attendees
+	// by their value, e.g. DECLINED. Attendees without PARTSTAT are missing.
+	PartStat map[string]string
+
+	// Modified is the time of the last modification (LAST-MODIFIED, or DTSTAMP as fallback).
+	Modified time.Time
+
+	// LeadDays is the number of calendar days from the time of the run until the event.
+	LeadDays int
+
+	// Skip is true if the event opts out of reminders (X-SMS-SKIP).
+	Skip bool
+
+	// Template overrides the message template for this event (X-SMS-TEMPLATE).
+	Template string
+
+	// Timezone is the IANA timezone of the recipient (X-SMS-TIMEZONE).
+	Timezone string
+
+	// Categories contains the values of all CATEGORIES properties.
+	Categories []string
+
+	// PhoneHint is the phone number of the recipient (X-SMS-PHONE).
+	// It takes precedence over numbers in the text of the event.
+	PhoneHint string
+
+	// Account is the name of the CalDav account containing the event
+	// (empty for an unnamed account).
+	Account string
+
+	// CalendarName is the display name of the calendar containing the event.
+	CalendarName string
+	// CalendarURL is the URL of the calendar collection containing the event.
+	CalendarURL string
+
+	// DisplayLocation is the location in which StartDate, StartTime and
+	// EndTime are rendered, regardless of the TZID of the event
+	// (nil = the location of Start and End). The dates of all-day
+	// events are never converted.
+	DisplayLocation *time.Location
 }
 
 func (event Event) String() string {
@@ -29,17 +85,121 @@ func (event Event) String() string {
 		properties = append(properties, fmt.Sprintf("comment: %s", event.Comment))
 	}
 
+	if len(event.Location) > 0 {
+		properties = append(properties, fmt.Sprintf("location: %s", event.Location))
+	}
+
+	if len(event.Organizer) > 0 {
+		properties = append(properties, fmt.Sprintf("organizer: %s", event.Organizer))
+	}
+
+	if len(event.CalendarName) > 0 {
+		properties = append(properties, fmt.Sprintf("calendar: %s", event.CalendarName))
+	}
+
 	return fmt.Sprintf("%s %s – %s (%s)", event.Start.Format(time.DateOnly), event.Start.Format(time.Kitchen), event.End.Format(time.Kitchen), strings.Join(properties, ", "))
 }
 
+// display returns t in the display location.
+func (e Event) display(t time.Time) time.Time {
+	if e.DisplayLocation == nil || e.AllDay {
+		return t
+	}
+	return t.In(e.DisplayLocation)
+}
+
 func (e Event) StartDate() string {
-	return e.Start.Format(time.DateOnly)
+	return e.display(e.Start).Format(time.DateOnly)
 }
 
 func (e Event) StartTime() string {
-	return fmt.Sprintf("%02d:%02d", e.Start.Hour(), e.Start.Minute())
+	start := e.display(e.Start)
+	return fmt.Sprintf("%02d:%02d", start.Hour(), start.Minute())
 }
 
 func (e Event) EndTime() string {
-	return fmt.Sprintf("%02d:%02d", e.End.Hour(), e.End.Minute())
+	end := e.display(e.End)
+	return fmt.Sprintf("%02d:%02d", end.Hour(), end.Minute())
+}
+
+// StartTime12 returns the start time in the 12-hour format, e.g. 3:30 PM.
+func (e Event) StartTime12() string {
+	return e.display(e.Start).Format("3:04 PM")
+}
+
+// EndTime12 returns the end time in the 12-hour format, e.g. 4:00 PM.
+func (e Event) EndTime12() string {
+	return e.display(e.End).Format("3:04 PM")
+}
+
+// LocalStart returns the start in the location in which StartTime is rendered.
+// Templates can format it with Go's layouts, e.g. {{ .LocalStart.Format "Mon 3:04 PM" }}.
+func (e Event) LocalStart() time.Time {
+	return e.display(e.Start)
+}
+
+// AttendeeCount returns the number of attendees.
+func (e Event) AttendeeCount() int {
+	return len(e.Attendees)
+}
+
+// AttendeePartStat returns the participation status of the attendee in upper case.
+// It defaults to NEEDS-ACTION (RFC 5545).
+func (e Event) AttendeePartStat(attendee string) string {
+	if v, ok := e.PartStat[attendee]; ok {
+		return v
+	}
+	return "NEEDS-ACTION"
+}
+
+// HasCategory returns true if the event has the category (case-insensitive).
+func (e Event) HasCategory(category string) bool {
+	category = strings.TrimSpace(category)
+	for _, c := range e.Categories {
+		if strings.EqualFold(c, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps returns true if the event overlaps [from, to).
+// An event without duration must start within the range.
+func (e Event) Overlaps(from, to time.Time) bool {
+	if !e.Start.Before(to) {
+		return false
+	}
+	return e.End.After(from) || (!e.End.After(e.Start) && !e.Start.Before(from))
+}
+
+// DaysUntil returns the number of calendar days from now until the start of the event.
+// Days are counted in the location of the event start, e.g. 1 for an event tomorrow.
+func (e Event) DaysUntil(now time.Time) int {
+	now = now.In(e.Start.Location())
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// Suppressed returns true if no reminder should be sent for the event,
+// because of the X-SMS-SKIP property or a line in the summary, description
+// or comment containing marker (case-insensitive).
+func (e Event) Suppressed(marker string) bool {
+	if e.Skip {
+		return true
+	}
+
+	marker = strings.ToLower(strings.TrimSpace(marker))
+	if marker == "" {
+		return false
+	}
+
+	for _, text := range []string{e.Summary, e.Description, e.Comment} {
+		for _, line := range strings.Split(text, "\n") {
+			if strings.Contains(strings.ToLower(line), marker) {
+				return true
+			}
+		}
+	}
+	return false
 }
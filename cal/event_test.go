@@ -0,0 +1,130 @@
+package cal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDaysUntil(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Vienna")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The evening before the switch to daylight saving time
+	now := time.Date(2025, 3, 29, 21, 0, 0, 0, loc)
+
+	tests := []struct {
+		start time.Time
+		want  int
+	}{
+		{time.Date(2025, 3, 29, 22, 0, 0, 0, loc), 0},
+		{time.Date(2025, 3, 30, 8, 0, 0, 0, loc), 1},
+		{time.Date(2025, 3, 31, 0, 0, 0, 0, loc), 2},
+		{time.Date(2025, 4, 1, 23, 59, 0, 0, loc), 3},
+		{time.Date(2025, 4, 5, 9, 0, 0, 0, loc), 7},
+		// 23:00 UTC is already the next day in Vienna
+		{time.Date(2025, 3, 29, 23, 0, 0, 0, time.UTC).In(loc), 1},
+	}
+
+	for _, test := range tests {
+		event := Event{Start: test.start}
+		if is, want := event.DaysUntil(now), test.want; is != want {
+			t.Fatalf("%s: %d != %d", test.start, is, want)
+		}
+	}
+}
+
+func TestSuppressed(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  bool
+	}{
+		{Event{Summary: "0660 4670967"}, false},
+		{Event{Description: "0660 4670967\n#nosms"}, true},
+		{Event{Description: "Ruft selbst an #NoSMS"}, true},
+		{Event{Comment: "#nosms"}, true},
+		{Event{Summary: "Lunch #nosms"}, true},
+		{Event{Skip: true}, true},
+	}
+
+	for _, test := range tests {
+		if is, want := test.event.Suppressed("#nosms"), test.want; is != want {
+			t.Fatalf("%s: %v != %v", test.event, is, want)
+		}
+	}
+
+	if (Event{Description: "#nosms"}).Suppressed("") {
+		t.Fatal("empty marker must not suppress")
+	}
+}
+
+func TestDisplayLocation(t *testing.T) {
+	vienna, err := time.LoadLocation("Europe/Vienna")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 1, 10, 23, 30, 0, 0, time.UTC)
+	event := Event{Start: start, End: start.Add(time.Hour)}
+	if is, want := event.StartDate()+" "+event.StartTime()+"-"+event.EndTime(), "2025-01-10 23:30-00:30"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+
+	event.DisplayLocation = vienna
+	if is, want := event.StartDate()+" "+event.StartTime()+"-"+event.EndTime(), "2025-01-11 00:30-01:30"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+
+	// The date of an all-day event stays the same.
+	day := Event{Start: time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC), AllDay: true, DisplayLocation: vienna}
+	if is, want := day.StartDate(), "2025-01-10"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+}
+
+func TestTime12(t *testing.T) {
+	start := time.Date(2025, 1, 10, 15, 30, 0, 0, time.UTC)
+	event := Event{Start: start, End: start.Add(9 * time.Hour)}
+	if is, want := event.StartTime12()+" – "+event.EndTime12(), "3:30 PM – 12:30 AM"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.DisplayLocation = ny
+	if is, want := event.StartTime12(), "10:30 AM"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+	if is, want := event.LocalStart().Format("Mon 3:04 PM"), "Fri 10:30 AM"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	from := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	tests := []struct {
+		start, end time.Time
+		want       bool
+	}{
+		{from.Add(9 * time.Hour), from.Add(10 * time.Hour), true},
+		// Started the day before
+		{from.Add(-time.Hour), from.Add(time.Hour), true},
+		{from.Add(-2 * time.Hour), from, false},
+		{to, to.Add(time.Hour), false},
+		// Without duration
+		{from, from, true},
+		{from.Add(-time.Hour), time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		event := Event{Start: test.start, End: test.end}
+		if is := event.Overlaps(from, to); is != test.want {
+			t.Fatalf("%s - %s: %t != %t", test.start, test.end, is, test.want)
+		}
+	}
+}
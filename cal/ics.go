@@ -0,0 +1,457 @@
+package cal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	ical "github.com/emersion/go-ical"
+)
+
+// Options configures which components of a calendar are returned as events.
+type Options struct {
+	// IncludeTodos returns tasks (VTODO) with a due date as events.
+	IncludeTodos bool
+}
+
+// ParseICS returns the events of the calendars in r.
+// Floating times and dates are in defaultTZ (time.Local if nil).
+// Recurring events are returned as is, see ParseICSInRange.
+func ParseICS(r io.Reader, defaultTZ *time.Location, opts Options) ([]Event, error) {
+	return ParseICSInRange(r, defaultTZ, time.Time{}, time.Time{}, opts)
+}
+
+// ParseICSInRange returns the events of the calendars in r like ParseICS.
+// Recurring events are expanded into their occurrences within [from, to).
+// Events which don't recur are returned regardless of the range.
+func ParseICSInRange(r io.Reader, defaultTZ *time.Location, from, to time.Time, opts Options) ([]Event, error) {
+	var out []Event
+	dec := ical.NewDecoder(r)
+	for {
+		c, err := dec.Decode()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		events, err := eventsFromCalendar(c, defaultTZ, from, to, opts)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, events...)
+	}
+}
+
+// eventsFromCalendar returns the events of a calendar.
+// Recurring events are expanded into their occurrences within [from, to).
+// If from is zero, recurring events are returned as is.
+// With opts.IncludeTodos, open tasks are returned as events
+// starting at their DUE (or DTSTART) date.
+func eventsFromCalendar(c *ical.Calendar, defaultTZ *time.Location, from, to time.Time, opts Options) ([]Event, error) {
+	if c == nil {
+		return nil, fmt.Errorf("nil calendar")
+	}
+	if defaultTZ == nil {
+		defaultTZ = time.Local
+	}
+
+	tzs := calendarTimezones(c)
+
+	overrides, err := recurrenceOverrides(c, tzs, defaultTZ)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Event
+	for _, c := range c.Children {
+		if c == nil {
+			continue
+		}
+
+		isTodo := c.Name == "VTODO"
+		if c.Name != "VEVENT" && !(isTodo && opts.IncludeTodos) {
+			continue
+		}
+
+		// Completed tasks need no reminder.
+		if isTodo && strings.EqualFold(firstPropValue(c.Props, "STATUS"), "COMPLETED") {
+			continue
+		}
+
+		uid := firstPropValue(c.Props, "UID")
+		if uid == "" {
+			uid = "(missing-uid)"
+		}
+
+		dtStart := firstProp(c.Props, "DTSTART")
+		if isTodo {
+			if due := firstProp(c.Props, "DUE"); due != nil {
+				dtStart = due
+			}
+		}
+		if dtStart == nil {
+			continue
+		}
+		start, startIsDate, err := parseICalDateTime(dtStart, tzs, defaultTZ)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s for %s: %w", dtStart.Name, uid, err)
+		}
+
+		var end time.Time
+		if dtEnd := firstProp(c.Props, "DTEND"); dtEnd != nil {
+			end, _, err = parseICalDateTime(dtEnd, tzs, defaultTZ)
+			if err != nil {
+				return nil, fmt.Errorf("parse DTEND for %s: %w", uid, err)
+			}
+		} else if duration := firstPropValue(c.Props, "DURATION"); duration != "" && dtStart.Name == "DTSTART" {
+			end, err = addDuration(start, duration)
+			if err != nil {
+				return nil, fmt.Errorf("parse DURATION for %s: %w", uid, err)
+			}
+		} else if startIsDate {
+			end = start.Add(24 * time.Hour)
+		} else {
+			end = start
+		}
+
+		var modified time.Time
+		for _, name := range []string{"LAST-MODIFIED", "DTSTAMP"} {
+			if p := firstProp(c.Props, name); p != nil {
+				if t, _, err := parseICalDateTime(p, tzs, defaultTZ); err == nil {
+					modified = t
+					break
+				}
+			}
+		}
+
+		event := Event{
+			UID:         uid,
+			Start:       start,
+			End:         end,
+			AllDay:      startIsDate,
+			Summary:     firstPropValue(c.Props, "SUMMARY"),
+			Description: firstPropValue(c.Props, "DESCRIPTION"),
+			Comment:     firstPropValue(c.Props, "COMMENT"),
+			Location:    firstPropText(c.Props, "LOCATION"),
+			Organizer:   organizer(firstProp(c.Props, "ORGANIZER")),
+			Status:      strings.ToUpper(firstPropValue(c.Props, "STATUS")),
+			Modified:    modified,
+			Attendees:   propValues(c.Props, "ATTENDEE"),
+			PartStat:    partStats(c.Props),
+			Skip:        isTrue(firstPropValue(c.Props, "X-SMS-SKIP")),
+			Template:    firstPropText(c.Props, "X-SMS-TEMPLATE"),
+			Timezone:    firstPropValue(c.Props, "X-SMS-TIMEZONE"),
+			PhoneHint:   firstPropText(c.Props, "X-SMS-PHONE"),
+			Categories:  categories(c.Props),
+		}
+
+		if p := firstProp(c.Props, "RECURRENCE-ID"); p != nil {
+			event.RecurrenceID, _, _ = parseICalDateTime(p, tzs, defaultTZ)
+
+			// The calendar query matches the whole resource, an override
+			// may have been moved out of the range.
+			if !from.IsZero() && !event.Overlaps(from, to) {
+				continue
+			}
+		}
+
+		if firstProp(c.Props, "RRULE") == nil || from.IsZero() {
+			out = append(out, event)
+			continue
+		}
+
+		starts, err := occurrences(c.Props, start, end.Sub(start), from, to, tzs, defaultTZ)
+		if err != nil {
+			return nil, fmt.Errorf("expand RRULE for %s: %w", uid, err)
+		}
+
+		for _, s := range starts {
+			if overrides[uid][s.Unix()] {
+				// Replaced by the override
+				continue
+			}
+
+			occurrence := event
+			occurrence.Start = s
+			occurrence.End = occurrenceEnd(s, start, end, startIsDate)
+			out = append(out, occurrence)
+		}
+	}
+	return out, nil
+}
+
+// recurrenceOverrides returns the start times of the occurrences of
+// recurring events which are overridden by a component with a RECURRENCE-ID, by UID.
+func recurrenceOverrides(c *ical.Calendar, tzs timezones, defaultTZ *time.Location) (map[string]map[int64]bool, error) {
+	overrides := map[string]map[int64]bool{}
+	for _, child := range c.Children {
+		if child == nil || (child.Name != "VEVENT" && child.Name != "VTODO") {
+			continue
+		}
+
+		p := firstProp(child.Props, "RECURRENCE-ID")
+		if p == nil {
+			continue
+		}
+
+		uid := firstPropValue(child.Props, "UID")
+		if uid == "" {
+			uid = "(missing-uid)"
+		}
+
+		t, _, err := parseICalDateTime(p, tzs, defaultTZ)
+		if err != nil {
+			return nil, fmt.Errorf("parse RECURRENCE-ID for %s: %w", uid, err)
+		}
+
+		if overrides[uid] == nil {
+			overrides[uid] = map[int64]bool{}
+		}
+		overrides[uid][t.Unix()] = true
+	}
+	return overrides, nil
+}
+
+func firstProp(props ical.Props, name string) *ical.Prop {
+	ps := props[name]
+	if len(ps) == 0 {
+		return nil
+	}
+	return &ps[0]
+}
+
+func firstPropValue(props ical.Props, name string) string {
+	p := firstProp(props, name)
+	if p == nil {
+		return ""
+	}
+	return strings.TrimSpace(p.Value)
+}
+
+// isTrue returns true for a boolean property value like TRUE, YES or 1.
+func isTrue(v string) bool {
+	switch strings.ToUpper(v) {
+	case "TRUE", "YES", "1":
+		return true
+	}
+	return false
+}
+
+// propValues returns the non-empty values of all properties with the name.
+func propValues(props ical.Props, name string) []string {
+	var out []string
+	for _, p := range props[name] {
+		if v := strings.TrimSpace(p.Value); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// partStats returns the PARTSTAT parameter of the ATTENDEE properties by their value.
+func partStats(props ical.Props) map[string]string {
+	var out map[string]string
+	for _, p := range props["ATTENDEE"] {
+		v := strings.TrimSpace(p.Value)
+		stat := strings.ToUpper(strings.TrimSpace(p.Params.Get(ical.ParamParticipationStatus)))
+		if v == "" || stat == "" {
+			continue
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		out[v] = stat
+	}
+	return out
+}
+
+// categories returns the categories of all CATEGORIES properties,
+// which each contain a comma separated list.
+func categories(props ical.Props) []string {
+	var out []string
+	for _, p := range props["CATEGORIES"] {
+		for _, v := range splitTextList(p.Value) {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// splitTextList splits a list of TEXT values at the commas
+// which are not escaped and unescapes the values.
+func splitTextList(s string) []string {
+	var out []string
+	var start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			out = append(out, textUnescaper.Replace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(out, textUnescaper.Replace(s[start:]))
+}
+
+// addDuration returns t plus the DURATION value s (RFC 5545, e.g. PT30M or P1W).
+// Days and weeks are added as calendar days. A negative duration returns t,
+// as an event can't end before it starts.
+func addDuration(t time.Time, s string) (time.Time, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	negative := strings.HasPrefix(v, "-")
+	v = strings.TrimLeft(v, "+-")
+	if !strings.HasPrefix(v, "P") || len(v) < 3 {
+		return time.Time{}, fmt.Errorf("invalid duration %q", s)
+	}
+	v = v[1:]
+
+	var days int
+	var d time.Duration
+	inTime := false
+	num := ""
+	for _, r := range v {
+		switch {
+		case r >= '0' && r <= '9':
+			num += string(r)
+			continue
+		case r == 'T' && !inTime && num == "":
+			inTime = true
+			continue
+		}
+
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid duration %q", s)
+		}
+		num = ""
+
+		switch {
+		case r == 'W' && !inTime:
+			days += 7 * n
+		case r == 'D' && !inTime:
+			days += n
+		case r == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case r == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case r == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return time.Time{}, fmt.Errorf("invalid duration %q", s)
+		}
+	}
+	if num != "" {
+		return time.Time{}, fmt.Errorf("invalid duration %q", s)
+	}
+
+	if negative {
+		return t, nil
+	}
+	return t.AddDate(0, 0, days).Add(d), nil
+}
+
+// organizer returns the common name (CN) of an ORGANIZER property,
+// or its address if the name is missing.
+func organizer(p *ical.Prop) string {
+	if p == nil {
+		return ""
+	}
+	if cn := strings.Trim(strings.TrimSpace(p.Params.Get("CN")), `"`); cn != "" {
+		return cn
+	}
+
+	v := strings.TrimSpace(p.Value)
+	if strings.HasPrefix(strings.ToLower(v), "mailto:") {
+		v = v[len("mailto:"):]
+	}
+	return v
+}
+
+// firstPropText returns the value of the first property with the name
+// with the TEXT escape sequences (\\, \;, \,, \n) resolved.
+func firstPropText(props ical.Props, name string) string {
+	return textUnescaper.Replace(firstPropValue(props, name))
+}
+
+// textUnescaper unescapes a TEXT value (RFC 5545 3.3.11).
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+// ErrMissingDateTime is returned for a missing or empty DATE or DATE-TIME property.
+var ErrMissingDateTime = errors.New("missing date-time")
+
+// DateTimeError is returned for a DATE or DATE-TIME value which can't be parsed.
+type DateTimeError struct {
+	Property string
+	Value    string
+	TZID     string
+}
+
+func (e *DateTimeError) Error() string {
+	msg := fmt.Sprintf("unsupported %s value %q", e.Property, e.Value)
+	if e.TZID != "" {
+		msg += fmt.Sprintf(" (TZID=%s)", e.TZID)
+	}
+	return msg
+}
+
+// dateTimeLayouts are the accepted layouts of DATE-TIME values. Besides the
+// basic format of RFC 5545 with or without seconds, some servers emit the
+// extended ISO 8601 format or a UTC offset instead of Z. Fractional seconds
+// are accepted by the parser in any layout with seconds.
+var dateTimeLayouts = []string{
+	"20060102T150405Z0700",
+	"20060102T1504Z0700",
+	"20060102T150405",
+	"20060102T1504",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// parseICalDateTime parses a DATE or DATE-TIME property. The TZID parameter
+// is resolved via tzs; floating times and dates are in defaultTZ.
+// Values in UTC or with an offset ignore the TZID.
+func parseICalDateTime(p *ical.Prop, tzs timezones, defaultTZ *time.Location) (time.Time, bool, error) {
+	if p == nil {
+		return time.Time{}, false, ErrMissingDateTime
+	}
+	if defaultTZ == nil {
+		defaultTZ = time.Local
+	}
+
+	v := strings.TrimSpace(p.Value)
+	if v == "" {
+		return time.Time{}, false, fmt.Errorf("%s: %w", p.Name, ErrMissingDateTime)
+	}
+
+	valueType := strings.ToUpper(strings.TrimSpace(p.Params.Get("VALUE")))
+	tzid := strings.TrimSpace(p.Params.Get("TZID"))
+
+	// All-day date
+	if valueType == "DATE" || !strings.Contains(v, "T") {
+		for _, layout := range []string{"20060102", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, v, defaultTZ); err == nil {
+				return t, true, nil
+			}
+		}
+		return time.Time{}, false, &DateTimeError{Property: p.Name, Value: v, TZID: tzid}
+	}
+
+	loc := tzs.location(tzid, defaultTZ)
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t, false, nil
+		}
+	}
+
+	return time.Time{}, false, &DateTimeError{Property: p.Name, Value: v, TZID: tzid}
+}
@@ -0,0 +1,605 @@
+package cal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	ical "github.com/emersion/go-ical"
+)
+
+// decodeCalendar decodes a single VCALENDAR from ics.
+func decodeCalendar(t *testing.T, ics string) *ical.Calendar {
+	t.Helper()
+
+	ics = strings.ReplaceAll(strings.TrimSpace(ics), "\n", "\r\n") + "\r\n"
+	c, err := ical.NewDecoder(strings.NewReader(ics)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestParseAttendees(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:group
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T090000Z
+SUMMARY:Rückenschule
+ATTENDEE;CN=Anna:mailto:anna@example.com
+ATTENDEE;CN=Ben:mailto:ben@example.com
+ATTENDEE:tel:+436604670967
+END:VEVENT
+END:VCALENDAR`)
+
+	events, err := eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := events[0].AttendeeCount(), 3; is != want {
+		t.Fatalf("%d attendees, want %d", is, want)
+	}
+}
+
+func TestIncludeTodos(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VTODO
+UID:followup
+DTSTAMP:20250101T000000Z
+DTSTART:20250105T090000Z
+DUE:20250110T090000Z
+SUMMARY:Kontrolle 0660 4670967
+END:VTODO
+BEGIN:VTODO
+UID:done
+DTSTAMP:20250101T000000Z
+DUE:20250110T100000Z
+STATUS:COMPLETED
+END:VTODO
+BEGIN:VTODO
+UID:undated
+DTSTAMP:20250101T000000Z
+END:VTODO
+END:VCALENDAR`)
+
+	events, err := eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("%d events without tasks", len(events))
+	}
+
+	events, err = eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{IncludeTodos: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("%d events, want 1", len(events))
+	}
+
+	e := events[0]
+	if is, want := e.Start, time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC); !is.Equal(want) {
+		t.Fatalf("%s != %s", is, want)
+	}
+	if is, want := e.Summary, "Kontrolle 0660 4670967"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+}
+
+func TestParseLastModified(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:modified
+DTSTAMP:20250101T000000Z
+LAST-MODIFIED:20250105T120000Z
+DTSTART:20250110T090000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:stamped
+DTSTAMP:20250102T000000Z
+DTSTART:20250110T100000Z
+END:VEVENT
+END:VCALENDAR`)
+
+	events, err := eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]time.Time{
+		"modified": time.Date(2025, 1, 5, 12, 0, 0, 0, time.UTC),
+		"stamped":  time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	for _, event := range events {
+		if !event.Modified.Equal(want[event.UID]) {
+			t.Fatalf("%s: %s != %s", event.UID, event.Modified, want[event.UID])
+		}
+	}
+}
+
+func TestParseSkipProperty(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:skip
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T090000Z
+X-SMS-SKIP:TRUE
+END:VEVENT
+BEGIN:VEVENT
+UID:remind
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T100000Z
+X-SMS-SKIP:FALSE
+END:VEVENT
+END:VCALENDAR`)
+
+	events, err := eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range events {
+		if is, want := event.Suppressed(""), event.UID == "skip"; is != want {
+			t.Fatalf("%s: %v != %v", event.UID, is, want)
+		}
+	}
+}
+
+func TestRecurringEvents(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:weekly
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Europe/Vienna:20250106T090000
+DTEND;TZID=Europe/Vienna:20250106T095000
+RRULE:FREQ=WEEKLY;BYDAY=MO
+EXDATE;TZID=Europe/Vienna:20250113T090000
+SUMMARY:Therapie 0660 4670967
+END:VEVENT
+BEGIN:VEVENT
+UID:bounded
+DTSTAMP:20250101T000000Z
+DTSTART:20250106T080000Z
+RRULE:FREQ=WEEKLY;COUNT=2
+SUMMARY:Kontrolle
+END:VEVENT
+BEGIN:VEVENT
+UID:until
+DTSTAMP:20250101T000000Z
+DTSTART:20250106T080000Z
+RRULE:FREQ=DAILY;UNTIL=20250110T080000Z
+SUMMARY:Kontrolle
+END:VEVENT
+BEGIN:VEVENT
+UID:birthday
+DTSTAMP:20250101T000000Z
+DTSTART;VALUE=DATE:19800120
+DTEND;VALUE=DATE:19800121
+RRULE:FREQ=YEARLY
+SUMMARY:Geburtstag
+END:VEVENT
+END:VCALENDAR`)
+
+	loc, err := time.LoadLocation("Europe/Vienna")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		day  time.Time
+		want []string
+	}{
+		{time.Date(2025, 1, 6, 0, 0, 0, 0, loc), []string{"weekly 09:00-09:50", "bounded 09:00-09:00", "until 09:00-09:00"}},
+		{time.Date(2025, 1, 10, 0, 0, 0, 0, loc), []string{"until 09:00-09:00"}},
+		{time.Date(2025, 1, 11, 0, 0, 0, 0, loc), nil},
+		{time.Date(2025, 1, 13, 0, 0, 0, 0, loc), []string{"bounded 09:00-09:00"}}, // excluded weekly
+		{time.Date(2025, 1, 20, 0, 0, 0, 0, loc), []string{"weekly 09:00-09:50", "birthday 00:00-00:00"}},
+	}
+
+	for _, test := range tests {
+		events, err := eventsFromCalendar(c, loc, test.day, test.day.AddDate(0, 0, 1), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var is []string
+		for _, event := range events {
+			event.Start, event.End = event.Start.In(loc), event.End.In(loc)
+			is = append(is, fmt.Sprintf("%s %s-%s", event.UID, event.StartTime(), event.EndTime()))
+
+			if event.StartDate() != test.day.Format(time.DateOnly) {
+				t.Fatalf("%s: occurrence on %s, want %s", event.UID, event.StartDate(), test.day.Format(time.DateOnly))
+			}
+			if event.UID == "birthday" && (!event.AllDay || event.End.Sub(event.Start) != 24*time.Hour) {
+				t.Fatalf("birthday: expected all-day occurrence, got %s – %s", event.Start, event.End)
+			}
+		}
+
+		if strings.Join(is, ", ") != strings.Join(test.want, ", ") {
+			t.Fatalf("%s: %v != %v", test.day.Format(time.DateOnly), is, test.want)
+		}
+	}
+}
+
+func TestParseCategories(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:categories
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T090000Z
+SUMMARY:Kontrolle 0660 4670967
+CATEGORIES:APPOINTMENT,Praxis\, Wien
+CATEGORIES:Follow-up
+END:VEVENT
+END:VCALENDAR`)
+
+	events, err := eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := events[0]
+	if is, want := strings.Join(event.Categories, "|"), "APPOINTMENT|Praxis, Wien|Follow-up"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+	if !event.HasCategory("appointment") || !event.HasCategory("follow-up") || event.HasCategory("Praxis") {
+		t.Fatalf("unexpected categories %v", event.Categories)
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:location
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T090000Z
+SUMMARY:Kontrolle 0660 4670967
+LOCATION:Praxis Dr. Müller\, 2nd floor
+END:VEVENT
+END:VCALENDAR`)
+
+	events, err := eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := template.Must(template.New("output").Parse("at {{ .Location }}"))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, events[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := buf.String(), "at Praxis Dr. Müller, 2nd floor"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+}
+
+func TestParseICS(t *testing.T) {
+	events, err := ParseICS(strings.NewReader(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:appointment
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Europe/Vienna:20250110T093000
+SUMMARY:Kontrolle 0660 4670967
+END:VEVENT
+END:VCALENDAR
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:all-day
+DTSTAMP:20250101T000000Z
+DTSTART;VALUE=DATE:20250111
+END:VEVENT
+END:VCALENDAR
+`), time.UTC, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]time.Time{
+		"appointment": time.Date(2025, 1, 10, 8, 30, 0, 0, time.UTC),
+		"all-day":     time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC),
+	}
+	if len(events) != len(want) {
+		t.Fatalf("%d events, expected %d", len(events), len(want))
+	}
+	for _, e := range events {
+		if !e.Start.Equal(want[e.UID]) {
+			t.Fatalf("%s starts at %s, expected %s", e.UID, e.Start, want[e.UID])
+		}
+	}
+
+	if _, err := ParseICS(strings.NewReader("BEGIN:VCALENDAR\nEND:VEVENT\n"), time.UTC, Options{}); err == nil {
+		t.Fatal("expected error for invalid calendar")
+	}
+}
+
+func TestParseOrganizer(t *testing.T) {
+	events, err := ParseICS(strings.NewReader(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:named
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T090000Z
+ORGANIZER;CN="Dr. Schmidt":mailto:schmidt@example.com
+END:VEVENT
+BEGIN:VEVENT
+UID:address
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T100000Z
+ORGANIZER:mailto:praxis@example.com
+END:VEVENT
+BEGIN:VEVENT
+UID:none
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T110000Z
+END:VEVENT
+END:VCALENDAR
+`), time.UTC, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"named":   "Dr. Schmidt",
+		"address": "praxis@example.com",
+		"none":    "",
+	}
+	for _, e := range events {
+		if e.Organizer != want[e.UID] {
+			t.Fatalf("%s: %q != %q", e.UID, e.Organizer, want[e.UID])
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	events, err := ParseICS(strings.NewReader(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:appointment
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Europe/Vienna:20250110T093000
+DURATION:PT30M
+END:VEVENT
+END:VCALENDAR
+`), time.UTC, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is, want := events[0].EndTime(), "10:00"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+
+	start := time.Date(2025, 3, 29, 9, 30, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"PT30M":        start.Add(30 * time.Minute),
+		"PT1H30M15S":   start.Add(time.Hour + 30*time.Minute + 15*time.Second),
+		"P1D":          start.AddDate(0, 0, 1),
+		"P1W":          start.AddDate(0, 0, 7),
+		"P1DT2H":       start.AddDate(0, 0, 1).Add(2 * time.Hour),
+		"+PT15M":       start.Add(15 * time.Minute),
+		"-PT15M":       start,
+		"P":            {},
+		"PT":           {},
+		"P1H":          {},
+		"PT1D":         {},
+		"P1":           {},
+		"30M":          {},
+		"P1DT2H30X":    {},
+		" pt45m ":      start.Add(45 * time.Minute),
+		"P2W1DT1H1M1S": start.AddDate(0, 0, 15).Add(time.Hour + time.Minute + time.Second),
+	}
+
+	for in, want := range tests {
+		is, err := addDuration(start, in)
+		if want.IsZero() {
+			if err == nil {
+				t.Fatalf("%q: expected error", in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if !is.Equal(want) {
+			t.Fatalf("%q: %s != %s", in, is, want)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	events, err := ParseICS(strings.NewReader(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:cancelled
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T090000Z
+STATUS:cancelled
+END:VEVENT
+BEGIN:VEVENT
+UID:confirmed
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T100000Z
+END:VEVENT
+END:VCALENDAR
+`), time.UTC, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"cancelled": "CANCELLED", "confirmed": ""}
+	for _, e := range events {
+		if e.Status != want[e.UID] {
+			t.Fatalf("%s: %q != %q", e.UID, e.Status, want[e.UID])
+		}
+	}
+}
+
+func TestRecurrenceOverride(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:weekly
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Europe/Vienna:20250106T090000
+DTEND;TZID=Europe/Vienna:20250106T095000
+RRULE:FREQ=WEEKLY;BYDAY=MO
+SUMMARY:Therapie 0660 4670967
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly
+DTSTAMP:20250101T000000Z
+RECURRENCE-ID;TZID=Europe/Vienna:20250113T090000
+DTSTART;TZID=Europe/Vienna:20250113T100000
+DTEND;TZID=Europe/Vienna:20250113T105000
+SUMMARY:Therapie (verschoben) 0660 4670967
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly
+DTSTAMP:20250101T000000Z
+RECURRENCE-ID;TZID=Europe/Vienna:20250120T090000
+DTSTART;TZID=Europe/Vienna:20250121T090000
+DTEND;TZID=Europe/Vienna:20250121T095000
+SUMMARY:Therapie 0660 4670967
+END:VEVENT
+END:VCALENDAR`)
+
+	loc, err := time.LoadLocation("Europe/Vienna")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		day  time.Time
+		want []string
+	}{
+		{time.Date(2025, 1, 6, 0, 0, 0, 0, loc), []string{"09:00 Therapie 0660 4670967"}},
+		{time.Date(2025, 1, 13, 0, 0, 0, 0, loc), []string{"10:00 Therapie (verschoben) 0660 4670967"}},
+		{time.Date(2025, 1, 20, 0, 0, 0, 0, loc), nil}, // moved to the next day
+		{time.Date(2025, 1, 21, 0, 0, 0, 0, loc), []string{"09:00 Therapie 0660 4670967"}},
+	}
+
+	for _, test := range tests {
+		events, err := eventsFromCalendar(c, loc, test.day, test.day.AddDate(0, 0, 1), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var is []string
+		for _, event := range events {
+			event.Start = event.Start.In(loc)
+			is = append(is, fmt.Sprintf("%s %s", event.StartTime(), event.Summary))
+		}
+
+		if strings.Join(is, ", ") != strings.Join(test.want, ", ") {
+			t.Fatalf("%s: %v != %v", test.day.Format(time.DateOnly), is, test.want)
+		}
+	}
+}
+
+func TestParseICalDateTime(t *testing.T) {
+	vienna, err := time.LoadLocation("Europe/Vienna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params ical.Params
+		value  string
+		want   time.Time
+		allDay bool
+	}{
+		// iCloud
+		{"icloud", ical.Params{"TZID": {"Europe/Vienna"}}, "20250110T093000", time.Date(2025, 1, 10, 9, 30, 0, 0, vienna), false},
+		{"icloud all-day", ical.Params{"VALUE": {"DATE"}}, "20250110", time.Date(2025, 1, 10, 0, 0, 0, 0, vienna), true},
+		// Google
+		{"google", nil, "20250110T083000Z", time.Date(2025, 1, 10, 8, 30, 0, 0, time.UTC), false},
+		{"google all-day", ical.Params{"VALUE": {"DATE"}}, "20250110", time.Date(2025, 1, 10, 0, 0, 0, 0, vienna), true},
+		// Nextcloud
+		{"nextcloud", ical.Params{"TZID": {"Europe/Berlin"}}, "20250110T093000", time.Date(2025, 1, 10, 9, 30, 0, 0, berlin), false},
+		{"nextcloud without seconds", ical.Params{"TZID": {"Europe/Berlin"}}, "20250110T0930", time.Date(2025, 1, 10, 9, 30, 0, 0, berlin), false},
+		// Other variants
+		{"utc without seconds", nil, "20250110T0830Z", time.Date(2025, 1, 10, 8, 30, 0, 0, time.UTC), false},
+		{"fractional seconds", nil, "20250110T083000.250Z", time.Date(2025, 1, 10, 8, 30, 0, 250000000, time.UTC), false},
+		{"floating", nil, "20250110T093000", time.Date(2025, 1, 10, 9, 30, 0, 0, vienna), false},
+		{"offset", ical.Params{"TZID": {"Europe/Berlin"}}, "20250110T093000+0100", time.Date(2025, 1, 10, 8, 30, 0, 0, time.UTC), false},
+		{"extended", nil, "2025-01-10T09:30:00+01:00", time.Date(2025, 1, 10, 8, 30, 0, 0, time.UTC), false},
+		{"extended floating", nil, "2025-01-10T09:30", time.Date(2025, 1, 10, 9, 30, 0, 0, vienna), false},
+		{"extended date", ical.Params{"VALUE": {"DATE"}}, "2025-01-10", time.Date(2025, 1, 10, 0, 0, 0, 0, vienna), true},
+	}
+
+	for _, test := range tests {
+		p := &ical.Prop{Name: "DTSTART", Params: test.params, Value: test.value}
+		is, allDay, err := parseICalDateTime(p, nil, vienna)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !is.Equal(test.want) || allDay != test.allDay {
+			t.Fatalf("%s: %s (all-day %v) != %s (all-day %v)", test.name, is, allDay, test.want, test.allDay)
+		}
+	}
+}
+
+func TestParseICalDateTimeErrors(t *testing.T) {
+	p := &ical.Prop{Name: "DTSTART", Params: ical.Params{"TZID": {"Europe/Vienna"}}, Value: "10.01.2025 09:30"}
+	_, _, err := parseICalDateTime(p, nil, time.UTC)
+
+	var dtErr *DateTimeError
+	if !errors.As(err, &dtErr) {
+		t.Fatalf("expected DateTimeError, got %v", err)
+	}
+	if dtErr.TZID != "Europe/Vienna" || !strings.Contains(err.Error(), "TZID=Europe/Vienna") {
+		t.Fatalf("TZID missing in %q", err)
+	}
+
+	_, _, err = parseICalDateTime(nil, nil, time.UTC)
+	if !errors.Is(err, ErrMissingDateTime) {
+		t.Fatalf("expected ErrMissingDateTime, got %v", err)
+	}
+	_, _, err = parseICalDateTime(&ical.Prop{Name: "DTEND"}, nil, time.UTC)
+	if !errors.Is(err, ErrMissingDateTime) {
+		t.Fatalf("expected ErrMissingDateTime, got %v", err)
+	}
+}
@@ -1,15 +1,52 @@
 package cal
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/nyaruka/phonenumbers"
 )
 
+// defaultRegion is used to parse numbers without a country code.
+var defaultRegion = "AT"
+
+// SetDefaultRegion sets the region (ISO 3166-1 alpha-2, e.g. "DE")
+// used to parse numbers without a country code.
+func SetDefaultRegion(code string) error {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if phonenumbers.GetCountryCodeForRegion(code) == 0 {
+		return fmt.Errorf("unknown region %q", code)
+	}
+
+	defaultRegion = code
+	return nil
+}
+
 // EventPhoneNumber returns the phone number stored in the event.
+// An explicit X-SMS-PHONE is used exclusively; if it is invalid,
+// no number is returned.
 func EventPhoneNumber(event Event) string {
+	if event.PhoneHint != "" {
+		if pn, _ := textPhoneNumber(event.PhoneHint); pn != nil {
+			return format(pn)
+		}
+		return ""
+	}
+
 	for _, str := range []string{event.Summary, event.Description, event.Comment} {
-		if pn := textPhoneNumber(str); pn != nil {
+		if pn, _ := textPhoneNumber(str); pn != nil {
+			return format(pn)
+		}
+	}
+
+	// Invited contacts, e.g. ATTENDEE;CN=Jane:tel:+436601234567
+	// Attendees who declined the invitation are not reminded.
+	for _, attendee := range event.Attendees {
+		if event.AttendeePartStat(attendee) == "DECLINED" {
+			continue
+		}
+		if pn := telPhoneNumber(attendee); pn != nil {
 			return format(pn)
 		}
 	}
@@ -20,13 +57,72 @@ func format(num *phonenumbers.PhoneNumber) string {
 	return phonenumbers.Format(num, phonenumbers.E164)
 }
 
-func textPhoneNumber(text string) *phonenumbers.PhoneNumber {
+// phoneLabel matches a label in front of a phone number, e.g. "Tel:" or "Handy".
+var phoneLabel = regexp.MustCompile(`(?i)^\s*(tel|telefon|phone|mobil|mobile|handy)\b\.?:?`)
+
+// phoneExtension matches an extension at the end of a line, e.g. "ext. 12" or "DW 12".
+var phoneExtension = regexp.MustCompile(`(?i)(\s+x|\s*\b(ext|dw|durchwahl)\b\.?:?)\s*\d{1,6}\s*$`)
+
+// phoneNote matches a note in parentheses at the end of a line, e.g. "(privat)".
+var phoneNote = regexp.MustCompile(`\s*\([^)0-9]*\)\s*$`)
+
+// phoneCandidate strips labels, notes and extensions around a phone number.
+func phoneCandidate(line string) string {
+	line = phoneLabel.ReplaceAllString(line, "")
+	line = phoneNote.ReplaceAllString(line, "")
+	return phoneExtension.ReplaceAllString(line, "")
+}
+
+// textPhoneNumber returns the first valid phone number in text
+// and the region (ISO 3166-1 alpha-2) it belongs to.
+// Every line is tried first; a number wrapped across lines is
+// found by trying the whole text as one line.
+func textPhoneNumber(text string) (*phonenumbers.PhoneNumber, string) {
 	lines := strings.Split(text, "\n")
+	if len(lines) > 1 {
+		lines = append(lines, strings.Join(lines, " "))
+	}
+
 	for _, line := range lines {
-		if pn, err := phonenumbers.Parse(line, "AT"); err == nil {
-			return pn
+		// Parse is lenient, e.g. it accepts "+43 1".
+		if pn, err := phonenumbers.Parse(phoneCandidate(line), defaultRegion); err == nil && phonenumbers.IsValidNumber(pn) {
+			return pn, phonenumbers.GetRegionCodeForNumber(pn)
 		}
 	}
 
-	return nil
+	return nil, ""
+}
+
+// NormalizePhoneNumber returns the phone number s in E.164 format,
+// or "" if s is not a valid phone number.
+func NormalizePhoneNumber(s string) string {
+	if pn, _ := textPhoneNumber(s); pn != nil {
+		return format(pn)
+	}
+	return ""
+}
+
+// PhoneNumberRegion returns the region (ISO 3166-1 alpha-2, e.g. "DE")
+// of a phone number returned by EventPhoneNumber, or "" if it is unknown.
+func PhoneNumberRegion(number string) string {
+	_, region := textPhoneNumber(number)
+	if region == "ZZ" {
+		return ""
+	}
+	return region
+}
+
+// telPhoneNumber parses a tel: URI (RFC 3966).
+func telPhoneNumber(uri string) *phonenumbers.PhoneNumber {
+	if len(uri) < 4 || !strings.EqualFold(uri[:4], "tel:") {
+		return nil
+	}
+
+	// Drop URI parameters like ;ext=12
+	num, _, _ := strings.Cut(uri[4:], ";")
+	pn, err := phonenumbers.Parse(num, defaultRegion)
+	if err != nil || !phonenumbers.IsValidNumber(pn) {
+		return nil
+	}
+	return pn
 }
@@ -3,6 +3,7 @@ package cal
 import (
 	"log"
 	"testing"
+	"time"
 )
 
 func TestValidPhoneNumbers(t *testing.T) {
@@ -17,7 +18,7 @@ func TestValidPhoneNumbers(t *testing.T) {
 	}
 
 	for in, out := range tests {
-		num := textPhoneNumber(in)
+		num, _ := textPhoneNumber(in)
 		if num == nil {
 			t.Fatalf("phone number expected for %s", in)
 		}
@@ -27,3 +28,158 @@ func TestValidPhoneNumbers(t *testing.T) {
 		}
 	}
 }
+
+func TestLabeledPhoneNumbers(t *testing.T) {
+	tests := map[string]string{
+		"Tel: 0660 4670967":                   "+436604670967",
+		"Mobil:0660 4670967":                  "+436604670967",
+		"Handy 0660 4670967 (privat)":         "+436604670967",
+		"Phone: +43 660 4670967 x12":          "+436604670967",
+		"Tel. +43 1 234567 DW 12":             "+431234567",
+		"Telefon: +43 1 234567 Durchwahl: 12": "+431234567",
+		"Tel: +43 1 234567 ext. 12":           "+431234567",
+		"Anna Muster\nTel: 0660\n4670967":     "+436604670967",
+	}
+
+	for in, out := range tests {
+		num, _ := textPhoneNumber(in)
+		if num == nil {
+			t.Fatalf("phone number expected for %q", in)
+		}
+
+		if is, want := format(num), out; is != want {
+			t.Fatalf("%s (from %q) != %s", is, in, want)
+		}
+	}
+}
+
+func TestInvalidPhoneNumbers(t *testing.T) {
+	tests := []string{
+		"+43 1",
+		"0660",
+		"+49 123",
+		"+43 660 1",
+	}
+
+	for _, in := range tests {
+		if num, _ := textPhoneNumber(in); num != nil {
+			t.Fatalf("unexpected phone number %s for %s", format(num), in)
+		}
+	}
+}
+
+func TestAttendeePhoneNumber(t *testing.T) {
+	event := Event{
+		Summary:   "Appointment",
+		Attendees: []string{"mailto:jane@example.com", "TEL:+43-660-4670967;ext=1"},
+	}
+
+	if is, want := EventPhoneNumber(event), "+436604670967"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+
+	event.Description = "0660 1234567"
+	if is, want := EventPhoneNumber(event), "+436601234567"; is != want {
+		t.Fatalf("%s != %s (text should take precedence)", is, want)
+	}
+}
+
+func TestPhoneHint(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:hint
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T090000Z
+SUMMARY:Appointment
+DESCRIPTION:Call back 0660 1234567
+X-SMS-PHONE:+43 660 4670967
+END:VEVENT
+END:VCALENDAR`)
+
+	events, err := eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := events[0]
+	if is, want := EventPhoneNumber(event), "+436604670967"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+
+	event.PhoneHint = "+43 1"
+	if is := EventPhoneNumber(event); is != "" {
+		t.Fatalf("unexpected number %s for an invalid X-SMS-PHONE", is)
+	}
+}
+
+func TestDeclinedAttendeeIsSkipped(t *testing.T) {
+	c := decodeCalendar(t, `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:shared
+DTSTAMP:20250101T000000Z
+DTSTART:20250110T090000Z
+SUMMARY:Appointment
+ATTENDEE;PARTSTAT=DECLINED:tel:+436604670967
+ATTENDEE;PARTSTAT=accepted:tel:+436601234567
+END:VEVENT
+END:VCALENDAR`)
+
+	events, err := eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := events[0]
+	if is, want := event.AttendeePartStat("tel:+436601234567"), "ACCEPTED"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+	if is, want := EventPhoneNumber(event), "+436601234567"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+
+	event.PartStat["tel:+436601234567"] = "DECLINED"
+	if is := EventPhoneNumber(event); is != "" {
+		t.Fatalf("unexpected number %s of a declined attendee", is)
+	}
+}
+
+func TestSetDefaultRegion(t *testing.T) {
+	defer SetDefaultRegion("AT")
+
+	if err := SetDefaultRegion("XX"); err == nil {
+		t.Fatal("expected error for unknown region")
+	}
+
+	if err := SetDefaultRegion("de"); err != nil {
+		t.Fatal(err)
+	}
+
+	num, _ := textPhoneNumber("0171 1234567")
+	if num == nil {
+		t.Fatal("phone number expected")
+	}
+	if is, want := format(num), "+491711234567"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+}
+
+func TestPhoneNumberRegion(t *testing.T) {
+	tests := map[string]string{
+		"+436604670967": "AT",
+		"+491711234567": "DE",
+		"+442071234567": "GB",
+		"invalid":       "",
+	}
+
+	for in, want := range tests {
+		if is := PhoneNumberRegion(in); is != want {
+			t.Fatalf("%s: %q != %q", in, is, want)
+		}
+	}
+}
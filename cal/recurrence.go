@@ -0,0 +1,97 @@
+package cal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ical "github.com/emersion/go-ical"
+	"github.com/teambition/rrule-go"
+)
+
+// occurrences returns the start times of the occurrences of a recurring event
+// which overlap the range [from, to). The first occurrence starts at dtStart
+// and every occurrence lasts for duration. EXDATE and RDATE are respected,
+// COUNT and UNTIL are part of the RRULE.
+func occurrences(props ical.Props, dtStart time.Time, duration time.Duration, from, to time.Time, tzs timezones, defaultTZ *time.Location) ([]time.Time, error) {
+	rruleProp := firstProp(props, "RRULE")
+	if rruleProp == nil {
+		return nil, fmt.Errorf("missing RRULE")
+	}
+
+	opt, err := rrule.StrToROptionInLocation(rruleProp.Value, dtStart.Location())
+	if err != nil {
+		return nil, err
+	}
+	opt.Dtstart = dtStart
+
+	rule, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return nil, err
+	}
+
+	set := rrule.Set{}
+	set.RRule(rule)
+
+	exdates, err := propDateTimes(props["EXDATE"], tzs, defaultTZ)
+	if err != nil {
+		return nil, fmt.Errorf("EXDATE: %w", err)
+	}
+	for _, t := range exdates {
+		set.ExDate(t)
+	}
+
+	rdates, err := propDateTimes(props["RDATE"], tzs, defaultTZ)
+	if err != nil {
+		return nil, fmt.Errorf("RDATE: %w", err)
+	}
+	for _, t := range rdates {
+		set.RDate(t)
+	}
+
+	var out []time.Time
+	for _, t := range set.Between(from.Add(-duration), to, true) {
+		if !t.Before(to) {
+			continue
+		}
+		// An occurrence overlaps the range if it ends after the range starts.
+		// Occurrences without duration must start within the range.
+		if t.Add(duration).After(from) || (duration == 0 && !t.Before(from)) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// occurrenceEnd returns the end of the occurrence starting at start
+// of an event which originally lasts from dtStart to dtEnd.
+// All-day events keep their number of days across DST changes.
+func occurrenceEnd(start, dtStart, dtEnd time.Time, allDay bool) time.Time {
+	if allDay {
+		days := int(dtEnd.Sub(dtStart).Round(24*time.Hour) / (24 * time.Hour))
+		return start.AddDate(0, 0, days)
+	}
+	return start.Add(dtEnd.Sub(dtStart))
+}
+
+// propDateTimes parses the date-time values of properties like EXDATE,
+// which may contain a comma-separated list of values.
+func propDateTimes(props []ical.Prop, tzs timezones, defaultTZ *time.Location) ([]time.Time, error) {
+	var out []time.Time
+	for _, p := range props {
+		for _, v := range strings.Split(p.Value, ",") {
+			if strings.TrimSpace(v) == "" {
+				continue
+			}
+
+			single := p
+			single.Value = v
+			t, _, err := parseICalDateTime(&single, tzs, defaultTZ)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
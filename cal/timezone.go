@@ -0,0 +1,35 @@
+package cal
+
+import (
+	"time"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// RecipientLocation returns the timezone of the recipient of an event.
+// The X-SMS-TIMEZONE property of the event takes precedence. Otherwise the
+// timezone is inferred from the phone number, if the number maps to exactly
+// one timezone. If neither works, fallback is returned.
+func RecipientLocation(event Event, number string, fallback *time.Location) *time.Location {
+	if event.Timezone != "" {
+		if loc, err := time.LoadLocation(event.Timezone); err == nil {
+			return loc
+		}
+	}
+
+	pn, err := phonenumbers.Parse(number, defaultRegion)
+	if err != nil {
+		return fallback
+	}
+
+	zones, err := phonenumbers.GetTimezonesForNumber(pn)
+	if err != nil || len(zones) != 1 {
+		return fallback
+	}
+
+	loc, err := time.LoadLocation(zones[0])
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
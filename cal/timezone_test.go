@@ -0,0 +1,29 @@
+package cal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecipientLocation(t *testing.T) {
+	fallback := time.UTC
+
+	tests := []struct {
+		event  Event
+		number string
+		want   string
+	}{
+		{Event{}, "+436604670967", "Europe/Vienna"},
+		{Event{}, "+4915112345678", "Europe/Berlin"},
+		{Event{Timezone: "America/New_York"}, "+436604670967", "America/New_York"},
+		{Event{Timezone: "Invalid/Zone"}, "+436604670967", "Europe/Vienna"},
+		{Event{}, "", "UTC"},
+	}
+
+	for _, test := range tests {
+		loc := RecipientLocation(test.event, test.number, fallback)
+		if is, want := loc.String(), test.want; is != want {
+			t.Fatalf("%s (tz %q): %s != %s", test.number, test.event.Timezone, is, want)
+		}
+	}
+}
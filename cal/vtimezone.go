@@ -0,0 +1,269 @@
+package cal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ical "github.com/emersion/go-ical"
+	"github.com/teambition/rrule-go"
+)
+
+// timezones maps TZIDs to the locations defined by
+// the VTIMEZONE components of a calendar.
+type timezones map[string]*time.Location
+
+// vtimezoneUntil limits the expansion of recurring timezone observances.
+var vtimezoneUntil = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// calendarTimezones returns the locations defined by the VTIMEZONE components of c.
+// Invalid definitions are logged and ignored.
+func calendarTimezones(c *ical.Calendar) timezones {
+	tzs := timezones{}
+	for _, child := range c.Children {
+		if child == nil || child.Name != "VTIMEZONE" {
+			continue
+		}
+
+		tzid := firstPropValue(child.Props, "TZID")
+		if tzid == "" {
+			continue
+		}
+
+		loc, err := vtimezoneLocation(tzid, child)
+		if err != nil {
+			slog.Warn("ignoring VTIMEZONE", "tzid", tzid, "err", err)
+			continue
+		}
+		tzs[tzid] = loc
+	}
+	return tzs
+}
+
+// location returns the location of tzid. The VTIMEZONE of the calendar
+// takes precedence over the system zoneinfo database; defaultTZ is
+// returned if neither knows the TZID.
+func (tzs timezones) location(tzid string, defaultTZ *time.Location) *time.Location {
+	if tzid == "" {
+		return defaultTZ
+	}
+
+	if loc, ok := tzs[tzid]; ok {
+		return loc
+	}
+
+	if loc, err := time.LoadLocation(tzid); err == nil {
+		return loc
+	}
+
+	return defaultTZ
+}
+
+// tzZone is a local time type of a timezone.
+type tzZone struct {
+	offset int // seconds east of UTC
+	dst    bool
+	name   string
+}
+
+// tzTransition is the instant at which a timezone switches to zone.
+type tzTransition struct {
+	at   time.Time
+	from int
+	zone tzZone
+}
+
+// vtimezoneLocation builds a location from the STANDARD and DAYLIGHT
+// observances of a VTIMEZONE component.
+func vtimezoneLocation(tzid string, c *ical.Component) (*time.Location, error) {
+	var transitions []tzTransition
+	for _, child := range c.Children {
+		if child == nil || (child.Name != "STANDARD" && child.Name != "DAYLIGHT") {
+			continue
+		}
+
+		from, err := parseUTCOffset(firstPropValue(child.Props, "TZOFFSETFROM"))
+		if err != nil {
+			return nil, fmt.Errorf("%s TZOFFSETFROM: %w", child.Name, err)
+		}
+
+		to, err := parseUTCOffset(firstPropValue(child.Props, "TZOFFSETTO"))
+		if err != nil {
+			return nil, fmt.Errorf("%s TZOFFSETTO: %w", child.Name, err)
+		}
+
+		onsets, err := observanceOnsets(child.Props)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", child.Name, err)
+		}
+
+		zone := tzZone{
+			offset: to,
+			dst:    child.Name == "DAYLIGHT",
+			name:   firstPropValue(child.Props, "TZNAME"),
+		}
+		if zone.name == "" {
+			zone.name = formatUTCOffset(to)
+		}
+
+		// Onsets are local times in the offset before the transition.
+		for _, t := range onsets {
+			transitions = append(transitions, tzTransition{
+				at:   t.Add(-time.Duration(from) * time.Second),
+				from: from,
+				zone: zone,
+			})
+		}
+	}
+
+	if len(transitions) == 0 {
+		return nil, fmt.Errorf("no observances")
+	}
+
+	sort.Slice(transitions, func(i, j int) bool {
+		return transitions[i].at.Before(transitions[j].at)
+	})
+
+	return time.LoadLocationFromTZData(tzid, tzif(transitions))
+}
+
+// observanceOnsets returns the local onsets (DTSTART, RRULE and RDATE)
+// of a timezone observance as floating times in UTC.
+func observanceOnsets(props ical.Props) ([]time.Time, error) {
+	dtStart := firstProp(props, "DTSTART")
+	if dtStart == nil {
+		return nil, fmt.Errorf("missing DTSTART")
+	}
+
+	start, _, err := parseICalDateTime(dtStart, nil, time.UTC)
+	if err != nil {
+		return nil, fmt.Errorf("DTSTART: %w", err)
+	}
+
+	onsets := []time.Time{start}
+	if p := firstProp(props, "RRULE"); p != nil {
+		opt, err := rrule.StrToROptionInLocation(p.Value, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("RRULE: %w", err)
+		}
+		opt.Dtstart = start
+
+		rule, err := rrule.NewRRule(*opt)
+		if err != nil {
+			return nil, fmt.Errorf("RRULE: %w", err)
+		}
+		onsets = rule.Between(start, vtimezoneUntil, true)
+	}
+
+	rdates, err := propDateTimes(props["RDATE"], nil, time.UTC)
+	if err != nil {
+		return nil, fmt.Errorf("RDATE: %w", err)
+	}
+	return append(onsets, rdates...), nil
+}
+
+// parseUTCOffset parses an UTC offset like +0100, -0500 or +053000
+// and returns the offset in seconds.
+func parseUTCOffset(s string) (int, error) {
+	if len(s) != 5 && len(s) != 7 {
+		return 0, fmt.Errorf("invalid UTC offset %q", s)
+	}
+
+	var sign int
+	switch s[0] {
+	case '+':
+		sign = 1
+	case '-':
+		sign = -1
+	default:
+		return 0, fmt.Errorf("invalid UTC offset %q", s)
+	}
+
+	var secs int
+	for i, unit := range []int{3600, 60, 1} {
+		if 1+2*i >= len(s) {
+			break
+		}
+
+		n, err := strconv.Atoi(s[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid UTC offset %q", s)
+		}
+		secs += n * unit
+	}
+	return sign * secs, nil
+}
+
+// formatUTCOffset returns the offset in seconds as +hhmm.
+func formatUTCOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+// tzif encodes the transitions in the TZif format (RFC 8536, version 2)
+// understood by time.LoadLocationFromTZData.
+func tzif(transitions []tzTransition) []byte {
+	// The first zone applies to times before the first transition.
+	first := tzZone{offset: transitions[0].from, name: formatUTCOffset(transitions[0].from)}
+	zones := []tzZone{first}
+	indexOf := func(z tzZone) int {
+		for i, zone := range zones {
+			if zone == z {
+				return i
+			}
+		}
+		zones = append(zones, z)
+		return len(zones) - 1
+	}
+
+	indices := make([]byte, len(transitions))
+	for i, t := range transitions {
+		indices[i] = byte(indexOf(t.zone))
+	}
+
+	var abbrevs strings.Builder
+	nameIndex := make([]int, len(zones))
+	for i, z := range zones {
+		nameIndex[i] = abbrevs.Len()
+		abbrevs.WriteString(z.name)
+		abbrevs.WriteByte(0)
+	}
+
+	var buf bytes.Buffer
+	header := func(timecnt, typecnt, charcnt int) {
+		buf.WriteString("TZif2")
+		buf.Write(make([]byte, 15))
+		for _, n := range []int{0, 0, 0, timecnt, typecnt, charcnt} {
+			binary.Write(&buf, binary.BigEndian, uint32(n))
+		}
+	}
+
+	// An empty version 1 block, followed by the 64-bit data.
+	header(0, 0, 0)
+	header(len(transitions), len(zones), abbrevs.Len())
+	for _, t := range transitions {
+		binary.Write(&buf, binary.BigEndian, t.at.Unix())
+	}
+	buf.Write(indices)
+	for i, z := range zones {
+		binary.Write(&buf, binary.BigEndian, int32(z.offset))
+		var dst byte
+		if z.dst {
+			dst = 1
+		}
+		buf.Write([]byte{dst, byte(nameIndex[i])})
+	}
+	buf.WriteString(abbrevs.String())
+	buf.WriteString("\n\n")
+
+	return buf.Bytes()
+}
@@ -0,0 +1,135 @@
+package cal
+
+import (
+	"testing"
+	"time"
+)
+
+const customTimezoneICS = `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VTIMEZONE
+TZID:Custom Central European Time
+BEGIN:DAYLIGHT
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+TZNAME:CEST
+DTSTART:19810329T020000
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU
+END:DAYLIGHT
+BEGIN:STANDARD
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+TZNAME:CET
+DTSTART:19961027T030000
+RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:winter
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Custom Central European Time:20250110T093000
+DTEND;TZID=Custom Central European Time:20250110T100000
+SUMMARY:Winter
+END:VEVENT
+BEGIN:VEVENT
+UID:summer
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Custom Central European Time:20250710T093000
+DTEND;TZID=Custom Central European Time:20250710T100000
+SUMMARY:Summer
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestVTimezone(t *testing.T) {
+	c := decodeCalendar(t, customTimezoneICS)
+	events, err := eventsFromCalendar(c, time.UTC, time.Time{}, time.Time{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]time.Time{
+		"winter": time.Date(2025, 1, 10, 8, 30, 0, 0, time.UTC),
+		"summer": time.Date(2025, 7, 10, 7, 30, 0, 0, time.UTC),
+	}
+	if len(events) != len(want) {
+		t.Fatalf("%d events, expected %d", len(events), len(want))
+	}
+
+	for _, e := range events {
+		if !e.Start.Equal(want[e.UID]) {
+			t.Fatalf("%s starts at %s, expected %s", e.UID, e.Start.UTC(), want[e.UID])
+		}
+	}
+}
+
+func TestVTimezoneRecurrenceAcrossDST(t *testing.T) {
+	ics := `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VTIMEZONE
+TZID:Custom
+BEGIN:DAYLIGHT
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+DTSTART:19810329T020000
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU
+END:DAYLIGHT
+BEGIN:STANDARD
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+DTSTART:19961027T030000
+RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:weekly
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Custom:20250320T093000
+DTEND;TZID=Custom:20250320T100000
+RRULE:FREQ=WEEKLY
+SUMMARY:Weekly
+END:VEVENT
+END:VCALENDAR
+`
+	c := decodeCalendar(t, ics)
+	from := time.Date(2025, 4, 3, 0, 0, 0, 0, time.UTC)
+	events, err := eventsFromCalendar(c, time.UTC, from, from.Add(24*time.Hour), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("%d events, expected 1", len(events))
+	}
+
+	// 09:30 local time in summer time
+	if is, want := events[0].Start.UTC(), time.Date(2025, 4, 3, 7, 30, 0, 0, time.UTC); !is.Equal(want) {
+		t.Fatalf("%s != %s", is, want)
+	}
+}
+
+func TestParseUTCOffset(t *testing.T) {
+	tests := map[string]int{
+		"+0100":   3600,
+		"-0500":   -5 * 3600,
+		"+053000": 5*3600 + 30*60,
+	}
+
+	for in, want := range tests {
+		is, err := parseUTCOffset(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if is != want {
+			t.Fatalf("%s: %d != %d", in, is, want)
+		}
+	}
+
+	if _, err := parseUTCOffset("0100"); err == nil {
+		t.Fatal("expected error")
+	}
+}
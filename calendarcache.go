@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// calendarCache stores the calendar data of calendar object resources
+// together with their ETags, so that unchanged resources are not
+// downloaded again.
+type calendarCache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// seen contains the hrefs used in this run.
+	// Only those are saved, which drops deleted and past resources.
+	seen map[string]bool
+
+	// tokens contains the sync tokens of calendars by URL.
+	// Like entries, only tokens used in this run are saved.
+	tokens     map[string]string
+	seenTokens map[string]bool
+}
+
+// cacheFile is the format of the cache on disk.
+type cacheFile struct {
+	Tokens  map[string]string     `json:"tokens"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+type cacheEntry struct {
+	ETag string `json:"etag"`
+	Data string `json:"data"`
+}
+
+// openCalendarCache loads (or creates) the JSON-backed cache at path.
+func openCalendarCache(path string) (*calendarCache, error) {
+	c := &calendarCache{
+		path:       path,
+		entries:    map[string]cacheEntry{},
+		seen:       map[string]bool{},
+		tokens:     map[string]string{},
+		seenTokens: map[string]bool{},
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, err
+	}
+
+	// An unreadable cache is rebuilt from the server.
+	var f cacheFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		slog.Warn("ignoring calendar cache", "path", path, "err", err)
+		return c, nil
+	}
+
+	for href, e := range f.Entries {
+		c.entries[href] = e
+	}
+	for u, token := range f.Tokens {
+		c.tokens[u] = token
+	}
+	return c, nil
+}
+
+// Get returns the cached data of the resource at href if its ETag is etag.
+func (c *calendarCache) Get(href, etag string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[href]
+	if !ok || etag == "" || e.ETag != etag {
+		return "", false
+	}
+
+	c.seen[href] = true
+	return e.Data, true
+}
+
+// Has returns true if the resource at href is cached with the ETag.
+func (c *calendarCache) Has(href, etag string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[href]
+	return ok && e.ETag == etag
+}
+
+// Put caches the data of the resource at href.
+// Resources without ETag are never returned by Get.
+func (c *calendarCache) Put(href, etag, data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[href] = cacheEntry{ETag: etag, Data: data}
+	c.seen[href] = true
+}
+
+// Delete removes the resource at href.
+func (c *calendarCache) Delete(href string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, href)
+	delete(c.seen, href)
+}
+
+// Collection returns the data of all cached resources of the calendar collection at u.
+func (c *calendarCache) Collection(u string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var hrefs []string
+	for href := range c.entries {
+		if strings.HasPrefix(href, u) {
+			hrefs = append(hrefs, href)
+		}
+	}
+	sort.Strings(hrefs)
+
+	out := make([]string, 0, len(hrefs))
+	for _, href := range hrefs {
+		c.seen[href] = true
+		out = append(out, c.entries[href].Data)
+	}
+	return out
+}
+
+// Token returns the sync token of the calendar at u.
+func (c *calendarCache) Token(u string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.tokens[u]
+}
+
+// SetToken sets the sync token of the calendar at u.
+// An empty token forces a full sync.
+func (c *calendarCache) SetToken(u, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tokens[u] = token
+	c.seenTokens[u] = true
+}
+
+// Save writes the resources used in this run to disk.
+func (c *calendarCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f := cacheFile{
+		Tokens:  map[string]string{},
+		Entries: map[string]cacheEntry{},
+	}
+	for href := range c.seen {
+		f.Entries[href] = c.entries[href]
+	}
+	for u := range c.seenTokens {
+		if c.tokens[u] != "" {
+			f.Tokens[u] = c.tokens[u]
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	// The calendar data contains personal data.
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+var configPath = flag.String("config", "", "JSON file with settings. Flags on the command line override the file.")
+
+// Config contains the settings which can be loaded from a file via -config.
+// This keeps secrets out of the shell history and process listings.
+type Config struct {
+	StateDir         string `json:"state-dir"`
+	Offset           *int   `json:"offset"`
+	Calendars        string `json:"calendars"`
+	CalendarsExclude string `json:"calendars-exclude"`
+	CalDAV           string `json:"caldav"`
+	SMSTemplate      string `json:"sms-template"`
+	Sender           string `json:"sms-sender"`
+	ASPSMSUserKey    string `json:"aspsms-userkey"`
+	ASPSMSPassword   string `json:"aspsms-password"`
+	AppleID          string `json:"apple-id"`
+	ApplePassword    string `json:"apple-password"`
+	Timezone         string `json:"timezone"`
+
+	// Accounts are additional CalDav accounts of which the events are reminded.
+	Accounts []AccountConfig `json:"accounts"`
+
+	// Templates maps calendar names to message templates.
+	// Events of other calendars use the default template.
+	Templates map[string]string `json:"templates"`
+
+	// RegionTemplates maps language tags (e.g. de-AT, de-DE or en) to
+	// message templates, which are chosen by the region of the phone number.
+	// Calendar templates take precedence.
+	RegionTemplates map[string]string `json:"region-templates"`
+
+	// Senders maps calendar names to SMS sender names.
+	// Events of other calendars are sent with -sms-sender.
+	Senders map[string]string `json:"senders"`
+}
+
+// LoadConfig reads the config file at path.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// apply sets the flags of fs which were not set on the command line.
+func (cfg *Config) apply(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	values := map[string]string{
+		"state-dir":         cfg.StateDir,
+		"calendars":         cfg.Calendars,
+		"calendars-exclude": cfg.CalendarsExclude,
+		"caldav":            cfg.CalDAV,
+		"sms-template":      cfg.SMSTemplate,
+		"sms-sender":        cfg.Sender,
+		"timezone":          cfg.Timezone,
+
+		"apple-id":       cfg.AppleID,
+		"apple-password": cfg.ApplePassword,
+	}
+	if cfg.Offset != nil {
+		values["offset"] = strconv.Itoa(*cfg.Offset)
+	}
+
+	for name, value := range values {
+		if value == "" || set[name] {
+			continue
+		}
+
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// envFlags maps flags to environment variables which are used
+// if the flag is not set on the command line.
+var envFlags = map[string]string{
+	"caldav":         "SMSREMIND_CALDAV",
+	"apple-id":       "CALDAV_APPLEID",
+	"apple-password": "CALDAV_PASSWORD",
+}
+
+// applyEnv sets the flags of fs which were not set on the command line
+// from their environment variables.
+func applyEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for name, key := range envFlags {
+		value, ok := os.LookupEnv(key)
+		if !ok || value == "" || set[name] || fs.Lookup(name) == nil {
+			continue
+		}
+
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setting returns the value of the environment variable key,
+// or value from the config file if the variable is not set.
+func setting(key, value string) (string, error) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v, nil
+	}
+
+	if value == "" {
+		return "", fmt.Errorf("required environment variable %q is not set", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var confirm = flag.Bool("confirm", false, "Print the planned reminders and ask for confirmation on the terminal before sending them. Without a terminal nothing is sent.")
+
+// confirmPlan asks whether the n planned reminders should be sent.
+// It returns false without asking if in is not a terminal.
+func confirmPlan(in *os.File, out io.Writer, n int) (bool, error) {
+	if !isTerminal(in) {
+		slog.Warn("-confirm requires an interactive terminal, not sending anything")
+		return false, nil
+	}
+
+	ok, err := ask(in, out, fmt.Sprintf("Send %d reminders?", n))
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		slog.Info("not confirmed, not sending anything")
+	}
+	return ok, nil
+}
+
+// ask prints the question and reads the answer from r.
+// Only "y" and "yes" confirm; anything else, including EOF, declines.
+func ask(r io.Reader, w io.Writer, question string) (bool, error) {
+	fmt.Fprintf(w, "%s [y/N] ", question)
+
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// isTerminal returns true if f is a character device, e.g. an interactive terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
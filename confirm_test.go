@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAsk(t *testing.T) {
+	tests := map[string]bool{
+		"y\n":     true,
+		"Yes\n":   true,
+		" y ":     true,
+		"n\n":     false,
+		"\n":      false,
+		"":        false,
+		"maybe\n": false,
+	}
+
+	for in, want := range tests {
+		var out bytes.Buffer
+		is, err := ask(strings.NewReader(in), &out, "Send 2 reminders?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if is != want {
+			t.Fatalf("%q: %v != %v", in, is, want)
+		}
+		if out.String() != "Send 2 reminders? [y/N] " {
+			t.Fatalf("unexpected prompt %q", out.String())
+		}
+	}
+}
+
+func TestConfirmPlanWithoutTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("y\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	ok, err := confirmPlan(f, &out, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("a file is not a terminal and must not confirm")
+	}
+	if out.Len() != 0 {
+		t.Fatalf("unexpected prompt %q", out.String())
+	}
+}
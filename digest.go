@@ -0,0 +1,266 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var authMode = flag.String("auth-mode", "auto", `Authentication at the CalDav server: "basic", "digest" (for servers which only accept HTTP Digest authentication, e.g. older SabreDAV setups) or "auto" (basic, digest if the server asks for it)`)
+
+// digestChallenge is a WWW-Authenticate challenge of HTTP Digest
+// authentication (RFC 7616).
+type digestChallenge struct {
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	// QOP is "auth" or empty if the server doesn't support it.
+	QOP string
+	// Stale is true if the request was rejected because of an
+	// expired nonce, not because of wrong credentials.
+	Stale bool
+}
+
+// parseDigestChallenge returns the Digest challenge of the
+// WWW-Authenticate headers of h.
+func parseDigestChallenge(h http.Header) (digestChallenge, bool) {
+	for _, v := range h.Values("WWW-Authenticate") {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+
+		var c digestChallenge
+		for key, value := range parseAuthParams(params) {
+			switch strings.ToLower(key) {
+			case "realm":
+				c.Realm = value
+			case "nonce":
+				c.Nonce = value
+			case "opaque":
+				c.Opaque = value
+			case "algorithm":
+				c.Algorithm = value
+			case "stale":
+				c.Stale = strings.EqualFold(value, "true")
+			case "qop":
+				for _, qop := range strings.Split(value, ",") {
+					if strings.TrimSpace(qop) == "auth" {
+						c.QOP = "auth"
+					}
+				}
+			}
+		}
+		if c.Nonce == "" || c.newHash() == nil {
+			continue
+		}
+		return c, true
+	}
+	return digestChallenge{}, false
+}
+
+// parseAuthParams parses comma-separated key=value pairs,
+// of which the values may be quoted strings containing commas.
+func parseAuthParams(s string) map[string]string {
+	out := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return out
+		}
+		key = strings.TrimSpace(key)
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value, s = b.String(), rest[min(i+1, len(rest)):]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		out[key] = value
+	}
+}
+
+// newHash returns the hash of the algorithm or nil if it isn't supported.
+func (c digestChallenge) newHash() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(c.Algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New()
+	case "SHA-256":
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
+func (c digestChallenge) hash(s string) string {
+	h := c.newHash()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorization returns the Authorization header of a request with
+// method to uri (the request URI, e.g. "/dav/calendars/"). count is the
+// number of requests sent with the nonce of the challenge, including this one.
+func (c digestChallenge) authorization(method, uri, user, pass, cnonce string, count int) string {
+	nc := fmt.Sprintf("%08x", count)
+
+	ha1 := c.hash(user + ":" + c.Realm + ":" + pass)
+	if strings.HasSuffix(strings.ToUpper(c.Algorithm), "-SESS") {
+		ha1 = c.hash(ha1 + ":" + c.Nonce + ":" + cnonce)
+	}
+	ha2 := c.hash(method + ":" + uri)
+
+	var response string
+	if c.QOP != "" {
+		response = c.hash(strings.Join([]string{ha1, c.Nonce, nc, cnonce, c.QOP, ha2}, ":"))
+	} else {
+		response = c.hash(ha1 + ":" + c.Nonce + ":" + ha2)
+	}
+
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+
+	params := []string{
+		"username=" + quote(user),
+		"realm=" + quote(c.Realm),
+		"nonce=" + quote(c.Nonce),
+		"uri=" + quote(uri),
+		"response=" + quote(response),
+	}
+	if c.Algorithm != "" {
+		params = append(params, "algorithm="+c.Algorithm)
+	}
+	if c.Opaque != "" {
+		params = append(params, "opaque="+quote(c.Opaque))
+	}
+	if c.QOP != "" {
+		params = append(params, "qop="+c.QOP, "nc="+nc, "cnonce="+quote(cnonce))
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+// digestTransport answers the Digest challenges of CalDav servers with
+// the Basic credentials of the requests, see -auth-mode.
+// The last challenge of every host is kept, so that later requests are
+// authorized in advance instead of being challenged again.
+type digestTransport struct {
+	base http.RoundTripper
+
+	mu sync.Mutex
+	// sessions contains the last challenge by host.
+	sessions map[string]*digestSession
+}
+
+// digestSession is a challenge and the number of requests which
+// were authorized with its nonce.
+type digestSession struct {
+	challenge digestChallenge
+	count     int
+}
+
+func newDigestTransport(base http.RoundTripper) *digestTransport {
+	return &digestTransport{base: base, sessions: map[string]*digestSession{}}
+}
+
+// authorize sets the Authorization header of req if a challenge of
+// the host is known. It returns the challenge or false.
+func (t *digestTransport) authorize(req *http.Request, user, pass string) (digestChallenge, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[req.URL.Host]
+	if !ok {
+		return digestChallenge{}, false
+	}
+	s.count++
+	req.Header.Set("Authorization", s.challenge.authorization(req.Method, req.URL.RequestURI(), user, pass, newCnonce(), s.count))
+	return s.challenge, true
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	user, pass, ok := req.BasicAuth()
+	if !ok || *authMode == "basic" {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request.
+	orig := req
+	req = orig.Clone(orig.Context())
+	sent, cached := t.authorize(req, user, pass)
+	// With -auth-mode digest the password is only sent as hash.
+	if !cached && *authMode == "digest" {
+		req.Header.Del("Authorization")
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge, ok := parseDigestChallenge(resp.Header)
+	if !ok {
+		return resp, nil
+	}
+	// The same nonce is only answered again if it expired,
+	// otherwise the credentials are wrong.
+	if cached && challenge.Nonce == sent.Nonce && !challenge.Stale {
+		return resp, nil
+	}
+	if orig.Body != nil && orig.GetBody == nil {
+		return resp, nil
+	}
+
+	t.mu.Lock()
+	t.sessions[orig.URL.Host] = &digestSession{challenge: challenge}
+	t.mu.Unlock()
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	req = orig.Clone(orig.Context())
+	if orig.GetBody != nil {
+		if req.Body, err = orig.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	t.authorize(req, user, pass)
+	return t.base.RoundTrip(req)
+}
+
+// newCnonce returns a random client nonce.
+func newCnonce() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validateAuthMode returns an error if -auth-mode is invalid.
+func validateAuthMode(mode string) error {
+	switch mode {
+	case "auto", "basic", "digest":
+		return nil
+	default:
+		return fmt.Errorf("invalid -auth-mode %q", mode)
+	}
+}
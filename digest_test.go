@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	// Example of RFC 2617, section 3.5
+	h := http.Header{}
+	h.Add("WWW-Authenticate", `Basic realm="testrealm@host.com"`)
+	h.Add("WWW-Authenticate", `Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+
+	c, ok := parseDigestChallenge(h)
+	if !ok {
+		t.Fatal("challenge expected")
+	}
+	if c.Realm != "testrealm@host.com" || c.QOP != "auth" || c.Opaque != "5ccc069c403ebaf9f0171e9517f40e41" {
+		t.Fatalf("unexpected challenge %+v", c)
+	}
+
+	auth := c.authorization("GET", "/dir/index.html", "Mufasa", "Circle Of Life", "0a4f113b", 1)
+	if !strings.Contains(auth, `response="6629fae49393a05397450978507c4ef1"`) {
+		t.Fatalf("unexpected authorization %s", auth)
+	}
+
+	h = http.Header{}
+	h.Set("WWW-Authenticate", `Digest realm="x", nonce="n", algorithm=SHA-512-256`)
+	if _, ok := parseDigestChallenge(h); ok {
+		t.Fatal("unsupported algorithm must be ignored")
+	}
+}
+
+func TestDoDAVDigest(t *testing.T) {
+	defer func(v string) { *authMode = v }(*authMode)
+
+	md5hex := func(s string) string {
+		b := md5.Sum([]byte(s))
+		return hex.EncodeToString(b[:])
+	}
+
+	var requests int
+	var nonce string
+	counts := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		challenge := `Digest realm="dav", nonce="` + nonce + `", qop="auth"`
+		scheme, params, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if scheme != "Digest" {
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		p := parseAuthParams(params)
+		if p["nonce"] != nonce {
+			w.Header().Set("WWW-Authenticate", challenge+", stale=true")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ha1 := md5hex("user:dav:secret")
+		ha2 := md5hex(r.Method + ":" + p["uri"])
+		// A nonce count must not be reused.
+		if counts[nonce+p["nc"]] || p["uri"] != r.URL.RequestURI() || p["response"] != md5hex(strings.Join([]string{ha1, nonce, p["nc"], p["cnonce"], "auth", ha2}, ":")) {
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		counts[nonce+p["nc"]] = true
+		w.WriteHeader(http.StatusMultiStatus)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/calendars/?x=1")
+	for _, mode := range []string{"auto", "digest"} {
+		*authMode, nonce = mode, "abc-"+mode
+		c := &http.Client{Transport: newDigestTransport(srv.Client().Transport)}
+
+		// The challenge is only answered once, later requests are authorized in advance.
+		for i, want := range []int{2, 1, 1} {
+			requests = 0
+			if _, _, _, err := doDAV(context.Background(), c, "REPORT", u, "user", "secret", "1", []byte("<report/>")); err != nil {
+				t.Fatalf("%s: %v", mode, err)
+			}
+			if requests != want {
+				t.Fatalf("%s %d: %d requests", mode, i, requests)
+			}
+		}
+
+		// An expired nonce is answered again.
+		nonce = "def-" + mode
+		requests = 0
+		if _, _, _, err := doDAV(context.Background(), c, "PROPFIND", u, "user", "secret", "0", nil); err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if requests != 2 {
+			t.Fatalf("%s stale: %d requests", mode, requests)
+		}
+
+		// Wrong credentials are not retried.
+		requests = 0
+		if _, _, status, _ := doDAV(context.Background(), c, "PROPFIND", u, "user", "wrong", "0", nil); status != http.StatusUnauthorized || requests != 1 {
+			t.Fatalf("%s: status %d after %d requests", mode, status, requests)
+		}
+	}
+
+	*authMode = "basic"
+	c := &http.Client{Transport: newDigestTransport(srv.Client().Transport)}
+	if _, _, status, _ := doDAV(context.Background(), c, "PROPFIND", u, "user", "secret", "0", nil); status != http.StatusUnauthorized {
+		t.Fatalf("unexpected status %d", status)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/brutella/smsremind/aspsms"
+)
+
+// Exit codes of a failed run, which let scripts and alerting
+// tell the causes apart.
+const (
+	exitFailure = 1 // other errors, e.g. of the state directory
+	exitUsage   = 2 // invalid flags, environment variables or config file
+	exitCalDAV  = 3 // the events couldn't be fetched, e.g. wrong credentials
+	exitASPSMS  = 4 // ASPSMS is unreachable or rejects the account
+	exitPartial = 5 // some reminders were not sent
+)
+
+// exitError sets the exit code of an error returned by run.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode returns err with the exit code or nil if err is nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// usageError returns err with the exit code of invalid settings.
+func usageError(err error) error {
+	return withExitCode(exitUsage, err)
+}
+
+// exitCode returns the exit code of the error returned by run.
+// Errors of the ASPSMS API have exitASPSMS if no code is set.
+func exitCode(err error) int {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+
+	if isASPSMSError(err) {
+		return exitASPSMS
+	}
+	return exitFailure
+}
+
+// isASPSMSError returns true if err is an error of the ASPSMS API.
+func isASPSMSError(err error) bool {
+	var apiErr *aspsms.Error
+	var httpErr *aspsms.HTTPError
+	return errors.As(err, &apiErr) || errors.As(err, &httpErr)
+}
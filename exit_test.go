@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/brutella/smsremind/aspsms"
+)
+
+func TestExitCode(t *testing.T) {
+	sendErr := withExitCode(exitPartial, errors.New("1 of 2 reminders failed"))
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("state"), exitFailure},
+		{usageError(errors.New("invalid -output")), exitUsage},
+		{fmt.Errorf("account a: %w", withExitCode(exitCalDAV, errors.New("401"))), exitCalDAV},
+		{&aspsms.Error{Code: aspsms.CodeInvalidPassword}, exitASPSMS},
+		{fmt.Errorf("credits: %w", &aspsms.HTTPError{StatusCode: 503}), exitASPSMS},
+		{errors.Join(sendErr, errors.New("cursor")), exitPartial},
+		// The failed sends are ASPSMS errors, but the run sent the others.
+		{withExitCode(exitPartial, &aspsms.Error{Code: aspsms.CodeInvalidRecipient}), exitPartial},
+	}
+
+	for _, test := range tests {
+		if is := exitCode(test.err); is != test.want {
+			t.Fatalf("%v: %d != %d", test.err, is, test.want)
+		}
+	}
+
+	if withExitCode(exitUsage, nil) != nil {
+		t.Fatal("nil expected")
+	}
+	if is, want := sendErr.Error(), "1 of 2 reminders failed"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+}
@@ -0,0 +1,33 @@
+package idempotency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLogAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for _, key := range []string{"a", "b"} {
+		l, err := OpenAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Append(map[string]string{"key": key}); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if is, want := string(b), "{\"key\":\"a\"}\n{\"key\":\"b\"}\n"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+}
@@ -0,0 +1,111 @@
+package idempotency
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CursorStore is a StateStore which records the progress of an interrupted
+// run, which lets the next run resume where it stopped.
+type CursorStore interface {
+	StateStore
+	// SetCursor stores the cursor, a JSON document. Nil deletes the cursor.
+	SetCursor(cursor json.RawMessage) error
+	// GetCursor returns the stored cursor or nil.
+	GetCursor() (json.RawMessage, error)
+}
+
+var (
+	_ CursorStore = (*Store)(nil)
+	_ CursorStore = (*MemoryStore)(nil)
+	_ CursorStore = (*SQLiteStore)(nil)
+)
+
+// SetCursor stores the cursor next to the store file (sent.json → sent.cursor.json).
+func (s *Store) SetCursor(cursor json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.cursorPath()
+	if cursor == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, cursor, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// GetCursor returns the stored cursor or nil.
+func (s *Store) GetCursor() (json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := os.ReadFile(s.cursorPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *Store) cursorPath() string {
+	return strings.TrimSuffix(s.path, filepath.Ext(s.path)) + ".cursor.json"
+}
+
+// SetCursor stores the cursor in memory.
+func (s *MemoryStore) SetCursor(cursor json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursor = append(json.RawMessage(nil), cursor...)
+	return nil
+}
+
+// GetCursor returns the stored cursor or nil.
+func (s *MemoryStore) GetCursor() (json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.cursor) == 0 {
+		return nil, nil
+	}
+	return append(json.RawMessage(nil), s.cursor...), nil
+}
+
+// SetCursor stores the cursor in the cursor table.
+func (s *SQLiteStore) SetCursor(cursor json.RawMessage) error {
+	if cursor == nil {
+		_, err := s.db.Exec(`DELETE FROM cursor`)
+		return err
+	}
+
+	_, err := s.db.Exec(`INSERT INTO cursor (id, data) VALUES (1, ?)
+ON CONFLICT(id) DO UPDATE SET data = excluded.data`, []byte(cursor))
+	return err
+}
+
+// GetCursor returns the stored cursor or nil.
+func (s *SQLiteStore) GetCursor() (json.RawMessage, error) {
+	var b []byte
+	err := s.db.QueryRow(`SELECT data FROM cursor WHERE id = 1`).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return b, err
+}
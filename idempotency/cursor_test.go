@@ -0,0 +1,42 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	dir := t.TempDir()
+	sqlite, err := OpenSQLite(filepath.Join(dir, "sent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlite.Close()
+
+	for _, s := range []CursorStore{NewMemoryStore(), mustOpen(t), sqlite} {
+		if c, err := s.GetCursor(); err != nil || c != nil {
+			t.Fatalf("unexpected cursor %s, %v", c, err)
+		}
+
+		for _, cursor := range []string{`{"calendars":["a"]}`, `{"calendars":["a","b"]}`} {
+			if err := s.SetCursor(json.RawMessage(cursor)); err != nil {
+				t.Fatal(err)
+			}
+			c, err := s.GetCursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if is := string(c); is != cursor {
+				t.Fatalf("%T: %s != %s", s, is, cursor)
+			}
+		}
+
+		if err := s.SetCursor(nil); err != nil {
+			t.Fatal(err)
+		}
+		if c, err := s.GetCursor(); err != nil || c != nil {
+			t.Fatalf("%T: unexpected cursor %s, %v", s, c, err)
+		}
+	}
+}
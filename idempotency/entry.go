@@ -0,0 +1,71 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Entry is the value recorded for a key.
+type Entry struct {
+	// Time is the time at which the key was marked.
+	Time time.Time `json:"time"`
+	// Recipient and Message are optional details of a sent message.
+	Recipient string `json:"recipient,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// UnmarshalJSON decodes an entry. It also accepts a bare timestamp,
+// which is how entries were stored before they had details.
+func (e *Entry) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*e = Entry{}
+		return json.Unmarshal(b, &e.Time)
+	}
+
+	// entry has no UnmarshalJSON method, which would recurse.
+	type entry Entry
+	var v entry
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*e = Entry(v)
+	return nil
+}
+
+// EntryStore is a StateStore which records the details of an entry.
+type EntryStore interface {
+	StateStore
+	// MarkEntry records the key with the details of e and the current timestamp.
+	MarkEntry(key string, e Entry) error
+	// Get returns the entry of the key.
+	Get(key string) (Entry, bool)
+}
+
+var (
+	_ EntryStore = (*Store)(nil)
+	_ EntryStore = (*MemoryStore)(nil)
+)
+
+// keysByPrefix returns the keys of data which start with prefix.
+func keysByPrefix(data map[string]Entry, prefix string) []string {
+	var out []string
+	for k := range data {
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// pruneLocked deletes all entries of data which were marked before cutoff.
+func pruneLocked(data map[string]Entry, cutoff time.Time) int {
+	var n int
+	for k, e := range data {
+		if e.Time.Before(cutoff) {
+			delete(data, k)
+			n++
+		}
+	}
+	return n
+}
@@ -15,7 +15,9 @@ type Lock struct {
 
 // AcquireLock creates an exclusive lock file.
 // If the lock already exists and is not stale, it returns an error.
-// If the lock is stale, it is removed and re-acquired.
+// If the lock is stale, it is removed and re-acquired. A lock of this host
+// is stale if its process has ended, a lock of another host if it is
+// older than maxAge.
 func AcquireLock(path string, maxAge time.Duration) (*Lock, error) {
 	now := time.Now().UTC()
 
@@ -30,13 +32,26 @@ func AcquireLock(path string, maxAge time.Duration) (*Lock, error) {
 		return nil, err
 	}
 
-	pid, ts, err := parseLockInfo(string(info))
+	pid, ts, host, err := parseLockInfo(string(info))
 	if err != nil {
 		return nil, fmt.Errorf("lock exists but is invalid: %w", err)
 	}
 
-	if now.Sub(ts) < maxAge {
-		return nil, fmt.Errorf("lock already held (pid=%d, age=%s)", pid, now.Sub(ts))
+	// The PID is only meaningful on the host which created the lock:
+	// a lock of this host is stale once its process is gone, however
+	// long the run takes. Locks of other or unknown hosts (shared state
+	// directory) expire by age.
+	var stale bool
+	if host != "" && host == hostname() {
+		stale = !processAlive(pid)
+	} else {
+		stale = now.Sub(ts) >= maxAge
+	}
+	if !stale {
+		if host == "" {
+			host = "unknown"
+		}
+		return nil, fmt.Errorf("lock already held (pid=%d host=%s age=%s)", pid, host, now.Sub(ts).Round(time.Second))
 	}
 
 	// Stale lock → remove and retry once
@@ -49,6 +64,23 @@ func AcquireLock(path string, maxAge time.Duration) (*Lock, error) {
 	return nil, errors.New("failed to acquire lock after removing stale lock")
 }
 
+// lockPollInterval is the interval at which AcquireLockWait retries.
+var lockPollInterval = 500 * time.Millisecond
+
+// AcquireLockWait acquires the lock like AcquireLock. If the lock is held,
+// it retries until the lock is released or wait has elapsed.
+// A wait of 0 tries once.
+func AcquireLockWait(path string, maxAge, wait time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		lock, err := AcquireLock(path, maxAge)
+		if err == nil || time.Now().Add(lockPollInterval).After(deadline) {
+			return lock, err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
 // Release removes the lock file.
 func (l *Lock) Release() error {
 	return os.Remove(l.path)
@@ -63,26 +95,41 @@ func tryCreateLock(path string, now time.Time) bool {
 	}
 	defer f.Close()
 
-	// Write: PID + timestamp (UTC)
-	_, _ = fmt.Fprintf(f, "%d %s\n", os.Getpid(), now.Format(time.RFC3339))
+	// Write: PID + timestamp (UTC) + hostname
+	_, _ = fmt.Fprintf(f, "%d %s %s\n", os.Getpid(), now.Format(time.RFC3339), hostname())
 	return true
 }
 
-func parseLockInfo(s string) (pid int, ts time.Time, err error) {
+// parseLockInfo parses the lock file content.
+// The hostname is empty for locks written by older versions.
+func parseLockInfo(s string) (pid int, ts time.Time, host string, err error) {
 	parts := strings.Fields(s)
 	if len(parts) < 2 {
-		return 0, time.Time{}, errors.New("invalid lock format")
+		return 0, time.Time{}, "", errors.New("invalid lock format")
 	}
 
 	pid, err = strconv.Atoi(parts[0])
 	if err != nil {
-		return 0, time.Time{}, err
+		return 0, time.Time{}, "", err
 	}
 
 	ts, err = time.Parse(time.RFC3339, parts[1])
 	if err != nil {
-		return 0, time.Time{}, err
+		return 0, time.Time{}, "", err
+	}
+
+	if len(parts) > 2 {
+		host = parts[2]
 	}
 
-	return pid, ts, nil
+	return pid, ts, host, nil
+}
+
+// hostname returns the name of the host, or "" if it is unknown.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return strings.ReplaceAll(name, " ", "_")
 }
@@ -0,0 +1,55 @@
+package idempotency
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseLockInfo(t *testing.T) {
+	pid, ts, host, err := parseLockInfo("1234 2025-01-10T09:00:00Z nodeA\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid != 1234 || host != "nodeA" || !ts.Equal(time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected lock info %d %s %s", pid, ts, host)
+	}
+
+	// Locks of older versions have no hostname.
+	pid, _, host, err = parseLockInfo("1234 2025-01-10T09:00:00Z\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid != 1234 || host != "" {
+		t.Fatalf("unexpected lock info %d %s", pid, host)
+	}
+
+	if _, _, _, err := parseLockInfo("1234"); err == nil {
+		t.Fatal("expected error for invalid lock")
+	}
+}
+
+func TestAcquireLockAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	old := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+
+	// A lock of a running process on this host is held however old it is.
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%d %s %s\n", os.Getpid(), old, hostname())), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireLock(path, time.Minute); err == nil {
+		t.Fatal("a live lock must not be taken over")
+	}
+
+	// Locks of other hosts expire by age.
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%d %s other-host\n", os.Getpid(), old)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := AcquireLock(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Release()
+}
@@ -0,0 +1,79 @@
+//go:build unix
+
+package idempotency
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeLock(t *testing.T, path string, pid int, host string) {
+	t.Helper()
+
+	data := fmt.Sprintf("%d %s %s\n", pid, time.Now().UTC().Format(time.RFC3339), host)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireLockOfCrashedProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simremind.lock")
+
+	// A PID above the maximum of Linux (2^22) and the BSDs
+	writeLock(t, path, 1<<30, hostname())
+
+	lock, err := AcquireLock(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Release()
+}
+
+func TestAcquireLockOfRunningProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simremind.lock")
+	writeLock(t, path, os.Getpid(), hostname())
+
+	if _, err := AcquireLock(path, time.Hour); err == nil {
+		t.Fatal("expected error for lock of a running process")
+	}
+}
+
+func TestAcquireLockOfOtherHost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simremind.lock")
+	writeLock(t, path, 1<<30, "other-host")
+
+	_, err := AcquireLock(path, time.Hour)
+	if err == nil {
+		t.Fatal("expected error for a recent lock of another host")
+	}
+	if !strings.Contains(err.Error(), "host=other-host") {
+		t.Fatalf("host missing in %q", err)
+	}
+}
+
+func TestAcquireLockWait(t *testing.T) {
+	defer func(d time.Duration) { lockPollInterval = d }(lockPollInterval)
+	lockPollInterval = 10 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "simremind.lock")
+	writeLock(t, path, os.Getpid(), hostname())
+
+	if _, err := AcquireLockWait(path, time.Hour, 50*time.Millisecond); err == nil {
+		t.Fatal("expected error for a lock which is not released")
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		os.Remove(path)
+	}()
+
+	lock, err := AcquireLockWait(path, time.Hour, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Release()
+}
@@ -0,0 +1,140 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// StateStore records keys of already performed operations.
+type StateStore interface {
+	// Exists returns true if the key already exists.
+	Exists(key string) bool
+	// Mark records the key.
+	Mark(key string) error
+	// MarkedAt returns the time at which the key was marked.
+	MarkedAt(key string) (time.Time, bool)
+	// Lookup returns the time at which the key was marked. Unlike
+	// MarkedAt, it returns an error if the store can't be read.
+	Lookup(key string) (time.Time, bool, error)
+	// Delete removes a key.
+	Delete(key string) error
+	// Keys returns a copy of all stored keys.
+	Keys() ([]string, error)
+	// KeysByPrefix returns the stored keys which start with prefix.
+	KeysByPrefix(prefix string) ([]string, error)
+	// Prune removes keys which were marked more than olderThan ago.
+	Prune(olderThan time.Duration) (int, error)
+	// Close releases the store.
+	Close() error
+}
+
+var (
+	_ StateStore = (*Store)(nil)
+	_ StateStore = (*MemoryStore)(nil)
+)
+
+// MemoryStore is a StateStore which only lives in memory.
+// It provides idempotency within a single process.
+type MemoryStore struct {
+	mu     sync.Mutex
+	data   map[string]Entry
+	cursor []byte
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string]Entry)}
+}
+
+// Exists returns true if the key already exists.
+func (s *MemoryStore) Exists(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.data[key]
+	return ok
+}
+
+// Mark records the key with the current timestamp.
+func (s *MemoryStore) Mark(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = Entry{Time: time.Now().UTC()}
+	return nil
+}
+
+// MarkEntry records the key with the details of e and the current timestamp.
+func (s *MemoryStore) MarkEntry(key string, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.Time = time.Now().UTC()
+	s.data[key] = e
+	return nil
+}
+
+// MarkedAt returns the time at which the key was marked.
+func (s *MemoryStore) MarkedAt(key string) (time.Time, bool) {
+	e, ok := s.Get(key)
+	return e.Time, ok
+}
+
+// Lookup returns the time at which the key was marked.
+// It never returns an error.
+func (s *MemoryStore) Lookup(key string) (time.Time, bool, error) {
+	t, ok := s.MarkedAt(key)
+	return t, ok, nil
+}
+
+// Get returns the entry of the key.
+func (s *MemoryStore) Get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.data[key]
+	return e, ok
+}
+
+// Delete removes a key.
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data, key)
+	return nil
+}
+
+// Keys returns a copy of all stored keys.
+func (s *MemoryStore) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]string, 0, len(s.data))
+	for k := range s.data {
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+// KeysByPrefix returns the stored keys which start with prefix.
+func (s *MemoryStore) KeysByPrefix(prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return keysByPrefix(s.data, prefix), nil
+}
+
+// Prune removes all keys which were marked more than olderThan ago
+// and returns the number of removed keys.
+func (s *MemoryStore) Prune(olderThan time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return pruneLocked(s.data, time.Now().Add(-olderThan)), nil
+}
+
+// Close is a no-op.
+func (s *MemoryStore) Close() error {
+	return nil
+}
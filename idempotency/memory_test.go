@@ -0,0 +1,75 @@
+package idempotency
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	var s StateStore = NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.Mark(fmt.Sprintf("key-%d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	keys, err := s.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is, want := len(keys), 10; is != want {
+		t.Fatalf("%d keys, want %d", is, want)
+	}
+
+	if !s.Exists("key-3") {
+		t.Fatal("key-3 expected")
+	}
+
+	if err := s.Delete("key-3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Exists("key-3") {
+		t.Fatal("key-3 not expected after delete")
+	}
+}
+
+func TestKeysByPrefix(t *testing.T) {
+	for _, s := range []StateStore{NewMemoryStore(), mustOpen(t)} {
+		for _, key := range []string{"a|1", "a|2", "b|1"} {
+			if err := s.Mark(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		keys, err := s.KeysByPrefix("a|")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(keys)
+		if is, want := strings.Join(keys, ","), "a|1,a|2"; is != want {
+			t.Fatalf("%s != %s", is, want)
+		}
+	}
+}
+
+func mustOpen(t *testing.T) *Store {
+	t.Helper()
+
+	s, err := Open(filepath.Join(t.TempDir(), "sent.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package idempotency
+
+// processAlive reports every process as alive, because liveness
+// can't be checked on this platform. Locks only expire by age.
+func processAlive(pid int) bool {
+	return true
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package idempotency
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processAlive returns true if a process with the pid exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	// Signal 0 only checks for existence. EPERM means the process
+	// exists but belongs to another user.
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,147 @@
+package idempotency
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	// A pure Go driver, which doesn't require cgo.
+	_ "modernc.org/sqlite"
+)
+
+var _ StateStore = (*SQLiteStore)(nil)
+
+// SQLiteStore is a StateStore backed by a SQLite database.
+// Unlike Store, marking a key only writes that key, which
+// keeps large stores fast.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens (or creates) a SQLite-backed idempotency store.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer only.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sent (
+	key TEXT PRIMARY KEY,
+	marked_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS cursor (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	data BLOB NOT NULL
+)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// The database contains personal data.
+	if err := os.Chmod(path, 0o600); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Exists returns true if the key already exists.
+// A failed query counts as not existing, see Lookup.
+func (s *SQLiteStore) Exists(key string) bool {
+	_, ok, _ := s.Lookup(key)
+	return ok
+}
+
+// Mark records the key with the current timestamp.
+// Calling Mark multiple times with the same key is safe.
+func (s *SQLiteStore) Mark(key string) error {
+	_, err := s.db.Exec(`INSERT INTO sent (key, marked_at) VALUES (?, ?)
+ON CONFLICT(key) DO UPDATE SET marked_at = excluded.marked_at`, key, time.Now().UnixNano())
+	return err
+}
+
+// MarkedAt returns the time at which the key was marked.
+// A failed query counts as not marked, see Lookup.
+func (s *SQLiteStore) MarkedAt(key string) (time.Time, bool) {
+	t, ok, _ := s.Lookup(key)
+	return t, ok
+}
+
+// Lookup returns the time at which the key was marked.
+// A failed query (e.g. a locked database) returns an error
+// instead of reporting the key as not marked.
+func (s *SQLiteStore) Lookup(key string) (time.Time, bool, error) {
+	var ns int64
+	err := s.db.QueryRow(`SELECT marked_at FROM sent WHERE key = ?`, key).Scan(&ns)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(0, ns).UTC(), true, nil
+}
+
+// Delete removes a key.
+func (s *SQLiteStore) Delete(key string) error {
+	_, err := s.db.Exec(`DELETE FROM sent WHERE key = ?`, key)
+	return err
+}
+
+// Keys returns a copy of all stored keys.
+func (s *SQLiteStore) Keys() ([]string, error) {
+	return s.queryKeys(`SELECT key FROM sent`)
+}
+
+// KeysByPrefix returns the stored keys which start with prefix.
+func (s *SQLiteStore) KeysByPrefix(prefix string) ([]string, error) {
+	// substr instead of LIKE, which treats % and _ in the prefix as wildcards.
+	return s.queryKeys(`SELECT key FROM sent WHERE substr(key, 1, length(?1)) = ?1`, prefix)
+}
+
+// queryKeys returns the keys selected by query.
+func (s *SQLiteStore) queryKeys(query string, args ...any) ([]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// Prune removes all keys which were marked more than olderThan ago
+// and returns the number of removed keys.
+func (s *SQLiteStore) Prune(olderThan time.Duration) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM sent WHERE marked_at < ?`, time.Now().Add(-olderThan).UnixNano())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,126 @@
+package idempotency
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent.db")
+
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Exists("a") {
+		t.Fatal("key not expected")
+	}
+	if err := s.Mark("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mark("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mark("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if at, ok := s.MarkedAt("a"); !ok || time.Since(at) > time.Minute {
+		t.Fatalf("unexpected marked at %s", at)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	if keys, err := reopened.Keys(); err != nil || len(keys) != 1 || keys[0] != "a" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestSQLiteKeysByPrefix(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "sent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, key := range []string{"a|1", "a|2", "a_b|1", "b|1"} {
+		if err := s.Mark(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := s.KeysByPrefix("a|")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if is, want := strings.Join(keys, ","), "a|1,a|2"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+	if keys, _ := s.KeysByPrefix("a_"); len(keys) != 1 {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestSQLitePrune(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "sent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Mark("new"); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour).UnixNano()
+	if _, err := s.db.Exec(`INSERT INTO sent (key, marked_at) VALUES (?, ?)`, "old", old); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("%d keys pruned, want 1", n)
+	}
+	if s.Exists("old") || !s.Exists("new") {
+		t.Fatal("only the old key must be pruned")
+	}
+}
+
+func TestSQLiteLookupError(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "sent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mark("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := s.Lookup("b"); ok || err != nil {
+		t.Fatalf("unexpected lookup of unknown key: %v %v", ok, err)
+	}
+
+	// A failed query must not count as "not marked".
+	s.Close()
+	if _, _, err := s.Lookup("a"); err == nil {
+		t.Fatal("error expected")
+	}
+	if _, err := s.KeysByPrefix("a"); err == nil {
+		t.Fatal("error expected")
+	}
+}
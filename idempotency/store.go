@@ -12,14 +12,18 @@ import (
 type Store struct {
 	path string
 	mu   sync.Mutex
-	data map[string]time.Time
+	data map[string]Entry
+
+	// deferred and dirty are set by DeferWrites and by changes in that mode.
+	deferred bool
+	dirty    bool
 }
 
 // Open loads (or creates) a JSON-backed idempotency store.
 func Open(path string) (*Store, error) {
 	s := &Store{
 		path: path,
-		data: make(map[string]time.Time),
+		data: make(map[string]Entry),
 	}
 
 	if err := s.load(); err != nil {
@@ -43,8 +47,40 @@ func (s *Store) Mark(key string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.data[key] = time.Now().UTC()
-	return s.saveLocked()
+	s.data[key] = Entry{Time: time.Now().UTC()}
+	return s.changedLocked()
+}
+
+// MarkEntry records the key with the details of e and the current timestamp.
+func (s *Store) MarkEntry(key string, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.Time = time.Now().UTC()
+	s.data[key] = e
+	return s.changedLocked()
+}
+
+// MarkedAt returns the time at which the key was marked.
+func (s *Store) MarkedAt(key string) (time.Time, bool) {
+	e, ok := s.Get(key)
+	return e.Time, ok
+}
+
+// Lookup returns the time at which the key was marked.
+// It never returns an error.
+func (s *Store) Lookup(key string) (time.Time, bool, error) {
+	t, ok := s.MarkedAt(key)
+	return t, ok, nil
+}
+
+// Get returns the entry of the key.
+func (s *Store) Get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.data[key]
+	return e, ok
 }
 
 // Delete removes a key (optional helper).
@@ -53,11 +89,11 @@ func (s *Store) Delete(key string) error {
 	defer s.mu.Unlock()
 
 	delete(s.data, key)
-	return s.saveLocked()
+	return s.changedLocked()
 }
 
 // Keys returns a copy of all stored keys.
-func (s *Store) Keys() []string {
+func (s *Store) Keys() ([]string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -65,7 +101,88 @@ func (s *Store) Keys() []string {
 	for k := range s.data {
 		out = append(out, k)
 	}
-	return out
+	return out, nil
+}
+
+// KeysByPrefix returns the stored keys which start with prefix.
+func (s *Store) KeysByPrefix(prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return keysByPrefix(s.data, prefix), nil
+}
+
+// Clear removes all keys.
+func (s *Store) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = make(map[string]Entry)
+	return s.changedLocked()
+}
+
+// Prune removes all keys which were marked more than olderThan ago
+// and returns the number of removed keys.
+func (s *Store) Prune(olderThan time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := pruneLocked(s.data, time.Now().Add(-olderThan))
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.changedLocked()
+}
+
+// Backup writes a copy of the store to path.
+// The file must not exist yet.
+func (s *Store) Backup(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// DeferWrites keeps changes in memory until Flush is called, instead of
+// rewriting the file on every change. Changes which are not flushed
+// are lost if the process crashes.
+func (s *Store) DeferWrites() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deferred = true
+}
+
+// Flush writes the changes which were deferred by DeferWrites.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	if err := s.saveLocked(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
 }
 
 // Close is a no-op but allows future extensions.
@@ -84,7 +201,8 @@ func (s *Store) load() error {
 		return err
 	}
 
-	var raw map[string]time.Time
+	// Entries of older stores are bare timestamps, see Entry.UnmarshalJSON.
+	var raw map[string]Entry
 	if err := json.Unmarshal(b, &raw); err != nil {
 		return err
 	}
@@ -93,6 +211,16 @@ func (s *Store) load() error {
 	return nil
 }
 
+// changedLocked writes the store or, after DeferWrites, remembers
+// that it has to be written by Flush.
+func (s *Store) changedLocked() error {
+	if s.deferred {
+		s.dirty = true
+		return nil
+	}
+	return s.saveLocked()
+}
+
 func (s *Store) saveLocked() error {
 	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
 		return err
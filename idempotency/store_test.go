@@ -0,0 +1,149 @@
+package idempotency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupAndClear(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sent.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mark("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := filepath.Join(dir, "sent.json.bak")
+	if err := s.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Backup(backup); err == nil {
+		t.Fatal("expected error when overwriting an existing backup")
+	}
+
+	if err := s.Clear(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Exists("a") {
+		t.Fatal("key not expected after clear")
+	}
+
+	b, err := Open(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Exists("a") {
+		t.Fatal("key expected in backup")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mark("new"); err != nil {
+		t.Fatal(err)
+	}
+	s.data["old"] = Entry{Time: time.Now().Add(-48 * time.Hour)}
+
+	n, err := s.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("%d keys pruned, want 1", n)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Exists("old") {
+		t.Fatal("old key not expected after prune")
+	}
+	if !reopened.Exists("new") {
+		t.Fatal("new key expected after prune")
+	}
+}
+
+func TestOpenOldFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent.json")
+	old := `{"a": "2025-01-09T08:00:00Z"}`
+	if err := os.WriteFile(path, []byte(old), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := s.Get("a")
+	if !ok {
+		t.Fatal("key expected")
+	}
+	if want := time.Date(2025, 1, 9, 8, 0, 0, 0, time.UTC); !e.Time.Equal(want) {
+		t.Fatalf("%s != %s", e.Time, want)
+	}
+
+	if err := s.MarkEntry("b", Entry{Recipient: "+436604670967", Message: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at, ok := reopened.MarkedAt("a"); !ok || !at.Equal(e.Time) {
+		t.Fatalf("unexpected time %s of migrated key", at)
+	}
+	e, ok = reopened.Get("b")
+	if !ok || e.Recipient != "+436604670967" || e.Message != "Hello" || e.Time.IsZero() {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestStoreDeferWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.DeferWrites()
+
+	if err := s.Mark("a"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Exists("a") {
+		t.Fatal("key expected before flush")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("file must not be written before flush: %v", err)
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Exists("a") {
+		t.Fatal("key expected after flush")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var oncePerDay = flag.Bool("once-per-day", false, "Exit without sending if a run with the same -offset already succeeded today (in -timezone). Protects against misfiring cron jobs.")
+
+// lastRuns contains the day (YYYY-MM-DD) of the last successful run by offset.
+type lastRuns map[string]string
+
+// readLastRuns returns the last runs stored in the file at path.
+// A missing file contains no runs.
+func readLastRuns(path string) (lastRuns, error) {
+	runs := lastRuns{}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return runs, nil
+		}
+		return nil, err
+	}
+
+	// A broken marker must not stop the reminders.
+	if err := json.Unmarshal(b, &runs); err != nil {
+		slog.Warn("ignoring last runs", "path", path, "err", err)
+		return lastRuns{}, nil
+	}
+	return runs, nil
+}
+
+// recordRun stores day as the last successful run for key in the file at path.
+func recordRun(path, key, day string) error {
+	runs, err := readLastRuns(path)
+	if err != nil {
+		return err
+	}
+	runs[key] = day
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// lastSuccess is the content of the file written by recordSuccess.
+type lastSuccess struct {
+	Time time.Time `json:"time"`
+}
+
+// readLastSuccess returns the time of the last successful run recorded
+// in the file at path. A missing file returns the zero time.
+func readLastSuccess(path string) (time.Time, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	var v lastSuccess
+	if err := json.Unmarshal(b, &v); err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return v.Time, nil
+}
+
+// recordSuccess stores t as the time of the last successful run in the file at path.
+func recordSuccess(path string, t time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(lastSuccess{Time: t.UTC()})
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lastrun.json")
+
+	runs, err := readLastRuns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 0 {
+		t.Fatalf("unexpected runs %v", runs)
+	}
+
+	if err := recordRun(path, "1", "2025-01-10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordRun(path, "7", "2025-01-09"); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordRun(path, "1", "2025-01-11"); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err = readLastRuns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs["1"] != "2025-01-11" || runs["7"] != "2025-01-09" {
+		t.Fatalf("unexpected runs %v", runs)
+	}
+}
+
+func TestReadInvalidLastRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lastrun.json")
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := readLastRuns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 0 {
+		t.Fatalf("unexpected runs %v", runs)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+var logLevel = flag.String("log-level", "info", `Minimum level of log messages: "debug", "info", "warn" or "error"`)
+var logFormat = flag.String("log-format", "text", `Format of log messages: "text" or "json"`)
+
+// setupLogging replaces the default logger with one writing to w
+// in the level and format of the flags. Every message carries the run ID.
+func setupLogging(w io.Writer, runID string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		return fmt.Errorf("invalid -log-level %q", *logLevel)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch *logFormat {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid -log-format %q", *logFormat)
+	}
+
+	slog.SetDefault(slog.New(h).With("run", runID))
+	return nil
+}
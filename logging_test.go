@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestSetupLogging(t *testing.T) {
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+	defer func(level, format string) { *logLevel, *logFormat = level, format }(*logLevel, *logFormat)
+
+	*logLevel, *logFormat = "warn", "json"
+
+	var buf bytes.Buffer
+	if err := setupLogging(&buf, "run-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	slog.Info("hidden")
+	slog.Warn("shown", "uid", "appointment")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON entry: %v\n%s", err, buf.String())
+	}
+	if entry["msg"] != "shown" || entry["run"] != "run-1" || entry["uid"] != "appointment" {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+
+	*logLevel = "verbose"
+	if err := setupLogging(&buf, "run-1"); err == nil {
+		t.Fatal("expected error for invalid level")
+	}
+}
@@ -4,41 +4,114 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"text/template"
 	"time"
 
 	"github.com/brutella/smsremind/aspsms"
 	"github.com/brutella/smsremind/cal"
 	"github.com/brutella/smsremind/idempotency"
-	ical "github.com/emersion/go-ical"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
 )
 
+// version is set at build time with -ldflags "-X main.version=1.2.0".
+var version = "dev"
+
+var userAgent = flag.String("user-agent", "smsremind/"+version, "User-Agent header of the requests to the CalDav server and to ASPSMS")
+
 var stateDir = flag.String("state-dir", ".", "Directory used to store internal states.")
+var storeType = flag.String("store", "file", `Where sent reminders are recorded: "file" (sent.json in -state-dir), "sqlite" (sent.db in -state-dir) or "memory" (not persisted)`)
+var storeSync = flag.String("store-sync", "each", `When -store file is written: "each" (after every sent reminder) or "end" (once at the end of the run, faster but a crash loses the record of the reminders sent so far)`)
+var storeMessages = flag.Bool("store-messages", false, "Record the recipient and the message text of sent reminders in the state (not supported by -store sqlite).")
+var lockWait = flag.Duration("lock-wait", 0, "Wait up to this long for another running instance to finish, e.g. 2m (0 exits immediately).")
+var stateTTL = flag.Duration("state-ttl", 0, "Remove sent reminders older than this from the state after every run, e.g. 2160h (0 keeps them forever). Must be longer than -offset days.")
+var since = flag.String("since", "", "Start of the range of events (RFC3339 or YYYY-MM-DD in -timezone) instead of the day at -offset.")
+var until = flag.String("until", "", "End of the range of events (RFC3339, or YYYY-MM-DD to include the whole day) instead of the day at -offset.")
 var offset = flag.Int("offset", 1, "Number of days in the future from now for which a reminder should be sent.")
 
 var calendars = flag.String("calendars", "", "Command separates list of calendar names")
-var caldav = flag.String("caldav", "", "URL of the CalDav server")
+var calendarsExclude = flag.String("calendars-exclude", "", "Comma separated list of calendar names which are skipped (e.g. Holidays,Birthdays)")
+var caldav = &stringList{}
+var etagCache = flag.Bool("etag-cache", false, "Cache calendar data in -state-dir and only download events which changed since the last run.")
+var syncCollection = flag.Bool("sync-collection", false, "Only fetch changes since the last run with sync-collection (RFC 6578). Requires -etag-cache.")
+var appleIDFlag = flag.String("apple-id", "", "Apple ID (user name) of the CalDav account (default $CALDAV_APPLEID)")
+var applePassword = flag.String("apple-password", "", "Password of the CalDav account, e.g. an app-specific password (default $CALDAV_PASSWORD)")
+var caldavTimeout = flag.Duration("caldav-timeout", 30*time.Second, "Timeout of every CalDav request")
+var calendarURL = flag.String("calendar-url", "", "URL of a calendar collection which is queried directly, skipping the discovery via -caldav")
+var headers = headerList{}
+var icsFile = flag.String("ics-file", "", "Read events from this iCalendar file instead of a CalDav server.")
+var includeTodos = flag.Bool("include-todos", false, "Also send reminders for tasks (VTODO) due in range.")
 
 var sender = flag.String("sms-sender", "Reminder", "The SMS sender name")
+var smsTimeout = flag.Duration("sms-timeout", 5*time.Second, "Timeout of every ASPSMS request")
+var smsAttempts = flag.Int("sms-attempts", 3, "Maximum number of attempts per SMS on network errors and HTTP 5xx responses")
+var deliverAt = flag.String("deliver-at", "", "Let ASPSMS deliver the reminders at this time (HH:MM) on the day of the event in the timezone of the recipient.")
+var concurrency = flag.Int("concurrency", 1, "Number of reminders which are sent at the same time")
+var maxSMS = flag.Int("max-sms", 50, "Stop with an error when this many SMS were sent in a run (0 = unlimited). Protects against runaway calendars.")
+var flash = flag.Bool("flash", false, "Send the reminders as flash SMS (class 0), which are displayed immediately instead of being stored in the inbox.")
+var aspsmsTransport = flag.String("aspsms-transport", "get", `How requests are sent to ASPSMS: "get" (parameters in the URL) or "post" (parameters in the request body, which keeps the message text and the credentials out of proxy and server logs)`)
+var smsMaxParts = flag.Int("sms-max-parts", 0, "Fail instead of sending messages which are split into more SMS (0 = no limit).")
 var msg = flag.String("sms-template", "Your next appointment is on {{ .StartDate }} at {{ .StartTime }}", "The SMS template")
+var templateVersion = flag.String("template-version", "", "Version of the SMS template, stored with every sent reminder.")
+var resendTemplate = flag.Bool("resend-template", false, "Resend reminders which were sent with a different -template-version.")
 
+var auditLogPath = flag.String("audit-log", "", "Append a JSON line for every sent reminder to this file.")
+var auditFull = flag.Bool("audit-full", false, "Write the full recipient number and message text to the audit log instead of a masked number and a message hash.")
 var dryRun = flag.Bool("dry-run", false, "Do not send SMS – only print.")
+var explain = flag.Bool("explain", false, "Print the decision for every event in range (sent, skipped and why).")
+var output = flag.String("output", "text", `Format of the planned reminders and of -status: "text" or "json" (one object per line)`)
+var remindCancelled = flag.Bool("remind-cancelled", false, "Send reminders for cancelled events (STATUS:CANCELLED).")
+var minAttendees = flag.Int("min-attendees", 0, "Skip events with fewer attendees.")
+var maxAttendees = flag.Int("max-attendees", 0, "Skip events with more attendees, e.g. group sessions (0 = no limit).")
+var resendOnModify = flag.Bool("resend-on-modify", false, "Resend a reminder if the event was modified after the reminder was sent.")
+var summaryRegex = flag.String("summary-regex", "", `Only remind of events of which the summary matches this regular expression, e.g. "^Termin:" (empty disables the check).`)
+var requireCategory = flag.String("require-category", "", "Only remind of events with this CATEGORIES value (case-insensitive, empty disables the check).")
+var skipKeyword = flag.String("skip-keyword", "#nosms", "Skip events with this marker in the summary, description or comment (empty disables the marker).")
+var smsSandbox = flag.Bool("sms-sandbox", false, "Validate every reminder with the ASPSMS API (credentials, originator, recipient) without sending it.")
+var seedOnly = flag.Bool("seed-only", false, "Mark all reminders in range as sent without sending them. Use this once on initial deployment.")
+var duplicateThreshold = flag.Int("duplicate-threshold", 2, "Warn when a phone number is the recipient of at least this many distinct events in a run (0 disables the check).")
+var preflight = flag.Bool("preflight", false, "Check the template, ASPSMS credentials, CalDav calendars and state directory, then exit without sending.")
+var testSMS = flag.String("test-sms", "", "Send a test message to this phone number to verify the ASPSMS credentials and sender, then exit.")
+var checkCredits = flag.Bool("check-credits", false, "Print the credit balance of the ASPSMS accounts, then exit.")
+var minCredits = flag.Float64("min-credits", 0, "Abort the run before sending if no ASPSMS account has at least this many credits (0 disables the check).")
+var deliveryStatus = flag.String("delivery-status", "", "Print the delivery status of the message with this ASPSMS reference, then exit.")
+var resetState = flag.Bool("reset-state", false, "Back up and clear the sent reminders in -state-dir, then exit. Requires -yes.")
+var yes = flag.Bool("yes", false, "Confirm -reset-state.")
+var nowFlag = flag.String("now", "", "Run as if it were this time (RFC3339). Sending is disabled if the time is in the past.")
+var allowPastNow = flag.Bool("allow-past-now", false, "Allow sending when -now is in the past.")
 var timezone = flag.String("timezone", "Europe/Vienna", "Timezone location")
+var displayTimezone = flag.String("display-timezone", "", "Render the times in messages in this timezone regardless of the TZID of the event (default: the timezone of the event)")
+var defaultRegion = flag.String("default-region", "AT", "Region (ISO 3166-1 alpha-2) of phone numbers without a country code")
+
+func init() {
+	flag.Var(caldav, "caldav", "URL of the CalDav server (repeatable for multiple accounts, further URLs must contain the credentials)")
+	flag.Var(headers, "header", `Additional "Name: Value" header sent with every CalDav request (repeatable)`)
+}
 
 func main() {
 	if err := run(); err != nil {
-		log.Fatal(err)
+		slog.Error(err.Error())
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -50,132 +123,1154 @@ func RequireEnv(key string) (string, error) {
 	return value, nil
 }
 
-func run() error {
+// newRunID returns an ID which identifies a single invocation in the logs.
+func newRunID(now time.Time) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// printDeliveryStatus prints the delivery status of the message with the reference.
+// As the message may have been sent with any account, all accounts are asked.
+func printDeliveryStatus(accounts aspsms.Failover, ref string) error {
+	var status aspsms.Status
+	for _, c := range accounts {
+		var err error
+		status, err = c.DeliveryStatus(ref)
+		if err != nil {
+			return err
+		}
+		if status.State != aspsms.StateUnknown {
+			break
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "%s: %s", ref, status.State)
+	if !status.Time.IsZero() {
+		fmt.Fprintf(os.Stdout, " at %s", status.Time.Format(time.RFC3339))
+	}
+	if status.Description != "" {
+		fmt.Fprintf(os.Stdout, " (%s)", status.Description)
+	}
+	fmt.Fprintln(os.Stdout)
+	return nil
+}
+
+// printCredits prints the credit balance of every account.
+func printCredits(accounts aspsms.Failover) error {
+	for i, c := range accounts {
+		credits, err := c.Credits()
+		if err != nil {
+			return fmt.Errorf("account %d: %w", i+1, err)
+		}
+		fmt.Fprintf(os.Stdout, "account %d: %.2f credits\n", i+1, credits)
+	}
+	return nil
+}
+
+// testMessage is the message sent by -test-sms.
+const testMessage = "This is a test message of smsremind."
+
+// sendTestSMS sends a test message to num and prints the response of ASPSMS.
+// With -dry-run the message is only printed.
+func sendTestSMS(w io.Writer, accounts aspsms.Failover, num string) error {
+	recipient := cal.NormalizePhoneNumber(num)
+	if recipient == "" {
+		return fmt.Errorf("-test-sms: invalid phone number %q", num)
+	}
+
+	if *dryRun {
+		fmt.Fprintf(w, "test %s: %s\n", recipient, testMessage)
+		return nil
+	}
+
+	var result aspsms.SendResult
+	account, err := accounts.Do(func(c *aspsms.Client) error {
+		var err error
+		result, err = c.SendTextSMSResult(recipient, testMessage)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("-test-sms: %w", err)
+	}
+
+	fmt.Fprintf(w, "test %s: sent with account %d (code %d, reference %s, %d parts", recipient, account+1, result.Code, result.TransactionRef, result.Parts)
+	if result.Credits > 0 {
+		fmt.Fprintf(w, ", %.2f credits left", result.Credits)
+	}
+	fmt.Fprintln(w, ")")
+	return nil
+}
+
+// requireCredits returns an error if no account has at least min credits.
+func requireCredits(accounts aspsms.Failover, min float64) error {
+	var balances []string
+	for i, c := range accounts {
+		credits, err := c.Credits()
+		if err != nil {
+			slog.Warn("credits unknown", "account", i+1, "err", err)
+			balances = append(balances, "unknown")
+			continue
+		}
+		if credits >= min {
+			return nil
+		}
+		balances = append(balances, fmt.Sprintf("%.2f", credits))
+	}
+	return fmt.Errorf("not enough ASPSMS credits: %s (minimum %.2f)", strings.Join(balances, ", "), min)
+}
+
+// runTime returns the time as of which the run happens.
+// This is the real time unless it is overridden with -now.
+// If -now is in the past, sending is disabled unless -allow-past-now is set.
+func runTime(real time.Time) (time.Time, error) {
+	if *nowFlag == "" {
+		return real, nil
+	}
+
+	now, err := time.Parse(time.RFC3339, *nowFlag)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -now: %w", err)
+	}
+
+	if now.Before(real) && !*allowPastNow && !*dryRun {
+		slog.Warn("-now is in the past, not sending anything (use -allow-past-now to override)", "now", *nowFlag)
+		*dryRun = true
+	}
+	return now, nil
+}
+
+// caldavServer returns the CalDav server at rawURL and its credentials.
+// Credentials set via -apple-id and -apple-password take precedence over
+// credentials embedded in the URL.
+func caldavServer(rawURL string) (*cal.CaldavURL, error) {
+	server := &cal.CaldavURL{}
+	if rawURL != "" {
+		var err error
+		server, err = cal.ParseCaldavURL(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("-caldav: %w", err)
+		}
+	}
+
+	if *appleIDFlag != "" {
+		server.AppleID = *appleIDFlag
+	}
+	if *applePassword != "" {
+		server.Password = *applePassword
+		server.HasPass = true
+	}
+	server.Password = cal.NormalizeAppPassword(server.Password)
+	return server, nil
+}
+
+// newASPSMSClient returns a client for the ASPSMS account configured by the flags.
+func newASPSMSClient(userKey, password string, proxy func(*http.Request) (*url.URL, error)) *aspsms.Client {
+	policy := aspsms.RetryPolicy{MaxAttempts: *smsAttempts, BaseDelay: time.Second}
+	c := aspsms.NewClientWithRetry(userKey, password, *sender, *smsTimeout, policy)
+	c.SetMaxParts(*smsMaxParts)
+	c.SetFlash(*flash)
+	c.SetPost(*aspsmsTransport == "post")
+	c.SetProxy(proxy)
+	c.SetUserAgent(*userAgent)
+	return c
+}
+
+// aspsmsAccounts returns the clients of the primary ASPSMS account and of the
+// backup accounts configured via ASPSMS_USERKEY_<n> and ASPSMS_PASSWORD_<n> (n = 2, 3, …).
+func aspsmsAccounts(userKey, password string, proxy func(*http.Request) (*url.URL, error)) (aspsms.Failover, error) {
+	accounts := aspsms.Failover{newASPSMSClient(userKey, password, proxy)}
+	for n := 2; ; n++ {
+		userKey, ok := os.LookupEnv(fmt.Sprintf("ASPSMS_USERKEY_%d", n))
+		if !ok {
+			return accounts, nil
+		}
+
+		password, err := RequireEnv(fmt.Sprintf("ASPSMS_PASSWORD_%d", n))
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, newASPSMSClient(userKey, password, proxy))
+	}
+}
+
+func run() (err error) {
 	flag.Parse()
 
-	aspsmsUserkey, err := RequireEnv("ASPSMS_USERKEY")
+	runID := newRunID(time.Now())
+	if err := setupLogging(os.Stderr, runID); err != nil {
+		return usageError(err)
+	}
+
+	// Precedence: command line > environment > config file
+	if err := applyEnv(flag.CommandLine); err != nil {
+		return usageError(err)
+	}
+
+	cfg := &Config{}
+	if *configPath != "" {
+		var err error
+		if cfg, err = LoadConfig(*configPath); err != nil {
+			return usageError(err)
+		}
+		if err := cfg.apply(flag.CommandLine); err != nil {
+			return usageError(err)
+		}
+	}
+
+	if *output != "text" && *output != "json" {
+		return usageError(fmt.Errorf("invalid -output %q", *output))
+	}
+
+	if err := validateAuthMode(*authMode); err != nil {
+		return usageError(err)
+	}
+
+	if *aspsmsTransport != "get" && *aspsmsTransport != "post" {
+		return usageError(fmt.Errorf("invalid -aspsms-transport %q", *aspsmsTransport))
+	}
+
+	// ASPSMS rejects messages with invalid senders.
+	if *sender != "" {
+		if err := aspsms.ValidateOriginator(*sender); err != nil {
+			return usageError(fmt.Errorf("-sms-sender: %w", err))
+		}
+	}
+
+	deliveryClock, err := parseClock(*deliverAt)
 	if err != nil {
-		return err
+		return usageError(fmt.Errorf("invalid -deliver-at: %w", err))
 	}
 
-	aspsmsApiPwd, err := RequireEnv("ASPSMS_PASSWORD")
+	quiet, err := parseQuietHours(*quietStart, *quietEnd, *quietBehavior)
 	if err != nil {
-		return err
+		return usageError(err)
+	}
+
+	var summaryFilter *regexp.Regexp
+	if *summaryRegex != "" {
+		if summaryFilter, err = regexp.Compile(*summaryRegex); err != nil {
+			return usageError(fmt.Errorf("invalid -summary-regex: %w", err))
+		}
+	}
+
+	if err := cal.SetDefaultRegion(*defaultRegion); err != nil {
+		return usageError(fmt.Errorf("-default-region: %w", err))
+	}
+
+	if *resetState {
+		return resetStore(*yes)
+	}
+
+	if *listState {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		return printState(os.Stdout, store)
+	}
+
+	aspsmsUserkey, err := setting("ASPSMS_USERKEY", cfg.ASPSMSUserKey)
+	if err != nil {
+		return usageError(err)
+	}
+
+	aspsmsApiPwd, err := setting("ASPSMS_PASSWORD", cfg.ASPSMSPassword)
+	if err != nil {
+		return usageError(err)
 	}
 
 	if len(aspsmsUserkey) == 0 || len(aspsmsApiPwd) == 0 {
-		return errors.New("ASPSMS_USERKEY or ASPSMS_PASSWORD not specified")
+		return usageError(errors.New("ASPSMS_USERKEY or ASPSMS_PASSWORD not specified"))
 	}
 
-	appleID, err := RequireEnv("CALDAV_APPLEID")
+	proxy, err := proxyFunc(*httpProxy, *httpsProxy)
 	if err != nil {
-		return err
+		return usageError(err)
 	}
 
-	appPwd, err := RequireEnv("CALDAV_PASSWORD")
+	accounts, err := aspsmsAccounts(aspsmsUserkey, aspsmsApiPwd, proxy)
 	if err != nil {
-		return err
+		return usageError(err)
+	}
+
+	if *deliveryStatus != "" {
+		return withExitCode(exitASPSMS, printDeliveryStatus(accounts, *deliveryStatus))
+	}
+
+	if *checkCredits {
+		return withExitCode(exitASPSMS, printCredits(accounts))
 	}
 
-	if len(appleID) == 0 || len(appPwd) == 0 {
-		return errors.New("CALDAV_APPLEID or CALDAV_PASSWORD not specified")
+	if *testSMS != "" {
+		return withExitCode(exitASPSMS, sendTestSMS(os.Stdout, accounts, *testSMS))
+	}
+
+	var metrics runMetrics
+	if *metricsFile != "" {
+		defer func() {
+			if err != nil {
+				metrics.Errors++
+			}
+			if err := writeMetrics(*metricsFile, metrics, time.Now()); err != nil {
+				slog.Error("metrics", "err", err)
+			}
+		}()
+	}
+
+	// A local file needs no CalDav credentials.
+	var caldavAccts []caldavAccount
+	if *icsFile == "" {
+		if caldavAccts, err = caldavAccounts(*caldav, cfg.Accounts); err != nil {
+			return usageError(err)
+		}
+	}
+
+	// Pruning keys of reminders which are still in range would send them again.
+	if *stateTTL > 0 && *stateTTL <= time.Duration(*offset+1)*24*time.Hour {
+		return usageError(fmt.Errorf("-state-ttl %s must be longer than -offset %d days", *stateTTL, *offset))
 	}
 
 	msgTmpl, err := template.New("output").Parse(*msg)
 	if err != nil {
-		return err
+		return usageError(err)
+	}
+
+	// The templates are checked as of the run, see -now.
+	runNow, err := runTime(time.Now())
+	if err != nil {
+		return usageError(err)
+	}
+
+	// Unknown fields only fail on execution, check them before any network calls.
+	if _, err := checkTemplate(msgTmpl, runNow); err != nil {
+		return usageError(fmt.Errorf("invalid -sms-template: %w", err))
+	}
+
+	calendarTmpls, err := parseCalendarTemplates(cfg.Templates, runNow)
+	if err != nil {
+		return usageError(err)
+	}
+
+	regionTmpls, err := parseRegionTemplates(cfg.RegionTemplates, runNow)
+	if err != nil {
+		return usageError(err)
+	}
+
+	calendarSenders, err := parseCalendarSenders(cfg.Senders)
+	if err != nil {
+		return usageError(err)
+	}
+
+	if *minCredits > 0 {
+		if err := requireCredits(accounts, *minCredits); err != nil {
+			return withExitCode(exitASPSMS, err)
+		}
+	}
+
+	// SIGINT and SIGTERM stop the run before the next reminder is sent.
+	// After the first signal, the default behavior is restored, so that
+	// a second one terminates immediately (e.g. while waiting for -confirm).
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return usageError(fmt.Errorf("timezone: %w", err))
+	}
+
+	var displayLoc *time.Location
+	if *displayTimezone != "" {
+		if displayLoc, err = time.LoadLocation(*displayTimezone); err != nil {
+			return usageError(fmt.Errorf("-display-timezone: %w", err))
+		}
+	}
+
+	now := runNow.In(loc)
+	start, end, err := queryRange(now, loc)
+	if err != nil {
+		return usageError(err)
+	}
+
+	tlsConfig, err := caldavTLSConfig()
+	if err != nil {
+		return usageError(err)
+	}
+
+	// The account settings are set by accountQuery.
+	query := Query{
+		Start:   start,
+		End:     end,
+		Headers: http.Header(headers),
+
+		CalendarURL: *calendarURL,
+		TLS:         tlsConfig,
+		Proxy:       proxy,
+		Timeout:     *caldavTimeout,
+	}
+
+	if query.CalendarURL != "" {
+		if len(caldavAccts) > 1 {
+			return usageError(errors.New("-calendar-url requires a single CalDav account"))
+		}
+		if len(parseCalendarNames(*calendars)) > 0 {
+			slog.Warn("-calendars is ignored with -calendar-url")
+		}
+	}
+
+	if *icsFile != "" && (*preflight || *status || *etagCache) {
+		return usageError(errors.New("-preflight, -status and -etag-cache require a CalDav server, not -ics-file"))
+	}
+
+	var queries []Query
+	for _, account := range caldavAccts {
+		queries = append(queries, accountQuery(query, account))
+	}
+
+	if *preflight {
+		return runPreflight(ctx, query.Start, queries, msgTmpl, accounts)
+	}
+
+	if *status {
+		return runStatus(ctx, statusConfig{
+			Queries:     queries,
+			Accounts:    accounts,
+			Store:       openStore,
+			LastSuccess: filepath.Join(*stateDir, "lastsuccess.json"),
+			Now:         time.Now(),
+		})
 	}
 
 	lockPath := filepath.Join(*stateDir, "simremind.lock")
-	lock, err := idempotency.AcquireLock(lockPath, 1*time.Minute)
+	lock, err := idempotency.AcquireLockWait(lockPath, 1*time.Minute, *lockWait)
 	if err != nil {
-		// Another instance is running or lock is valid → exit quietly
-		os.Exit(0)
+		// Another instance is running. The error is returned, so that
+		// the deferred -metrics-file is written.
+		return fmt.Errorf("not running: %w", err)
 	}
 	defer lock.Release()
 
-	statePath := filepath.Join(*stateDir, "sent.json")
-	store, err := idempotency.Open(statePath)
+	if *oncePerDay {
+		path := filepath.Join(*stateDir, "lastrun.json")
+		key, day := strconv.Itoa(*offset), now.In(loc).Format(time.DateOnly)
+
+		var runs lastRuns
+		if runs, err = readLastRuns(path); err != nil {
+			return err
+		}
+		if runs[key] == day {
+			slog.Info("already ran today, not sending anything (-once-per-day)", "offset", *offset, "day", day)
+			return nil
+		}
+
+		defer func() {
+			// Only a successful run which may have sent reminders counts.
+			if err == nil && !*dryRun {
+				err = recordRun(path, key, day)
+			}
+		}()
+	}
+
+	defer func() {
+		// Reported by -status
+		if err == nil && !*dryRun {
+			err = recordSuccess(filepath.Join(*stateDir, "lastsuccess.json"), time.Now())
+		}
+	}()
+
+	store, err := openStore()
 	if err != nil {
 		return err
 	}
 	defer store.Close()
 
-	client := aspsms.NewClient(aspsmsUserkey, aspsmsApiPwd, *sender, 5*time.Second)
+	if fs, ok := store.(*idempotency.Store); ok {
+		// Also runs when the run is interrupted or fails.
+		defer func() {
+			if flushErr := fs.Flush(); flushErr != nil {
+				err = errors.Join(err, fmt.Errorf("-store-sync end: the reminders sent by this run were not recorded and may be sent again: %w", flushErr))
+			}
+		}()
+	}
 
-	ctx := context.Background()
-	loc, err := time.LoadLocation(*timezone)
-	if err != nil {
-		log.Fatal("timezone:", err)
+	var audit *idempotency.AuditLog
+	if *auditLogPath != "" {
+		audit, err = idempotency.OpenAuditLog(*auditLogPath)
+		if err != nil {
+			return err
+		}
+		defer audit.Close()
 	}
 
-	day := time.Now().AddDate(0, 0, *offset)
-	query := Query{
-		Endpoint:  *caldav,
-		AppleId:   appleID,
-		Password:  appPwd,
-		Start:     startOfDay(day, loc),
-		End:       endOfDay(day, loc),
-		Calendars: parseCalendarNames(*calendars),
+	if *etagCache {
+		query.Cache, err = openCalendarCache(filepath.Join(*stateDir, "calendars.json"))
+		if err != nil {
+			return err
+		}
+		query.Sync = *syncCollection
+	} else if *syncCollection {
+		return usageError(errors.New("-sync-collection requires -etag-cache"))
+	}
+
+	source := func(ctx context.Context) ([]cal.Event, error) {
+		if *icsFile != "" {
+			return readICSFile(*icsFile, loc, query.Start, query.End)
+		}
+
+		var events []cal.Event
+		for _, account := range caldavAccts {
+			evs, err := execute(ctx, accountQuery(query, account), loc)
+			if err != nil {
+				if len(caldavAccts) > 1 {
+					err = fmt.Errorf("account %s: %w", account, err)
+				}
+				return nil, withExitCode(exitCalDAV, err)
+			}
+			events = append(events, evs...)
+		}
+		if query.Cache != nil {
+			if err := query.Cache.Save(); err != nil {
+				return nil, err
+			}
+		}
+		return events, nil
 	}
-	events, err := execute(ctx, query, loc)
+
+	var resumed map[string]bool
+	if *resume && *icsFile == "" {
+		if resumed, err = resumedCalendars(store, query.Start, query.End); err != nil {
+			return err
+		}
+		if len(resumed) > 0 {
+			slog.Info("resuming interrupted run", "calendars-done", len(resumed))
+		}
+		query.SkipCalendars = resumed
+	}
+
+	reminders, err := plan(ctx, planConfig{
+		Events:             source,
+		Now:                now,
+		Store:              store,
+		Summary:            summaryFilter,
+		RemindCancelled:    *remindCancelled,
+		MinAttendees:       *minAttendees,
+		MaxAttendees:       *maxAttendees,
+		SkipKeyword:        *skipKeyword,
+		RequireCategory:    *requireCategory,
+		DuplicateThreshold: *duplicateThreshold,
+		ResendOnModify:     *resendOnModify,
+		SeedOnly:           *seedOnly,
+		DisplayLocation:    displayLoc,
+		Template:           msgTmpl,
+		CalendarTemplates:  calendarTmpls,
+		RegionTemplates:    regionTmpls,
+	})
 	if err != nil {
 		return err
 	}
 
-	for _, event := range events {
-		num := cal.EventPhoneNumber(event)
-		if num == "" {
-			// Skip if no phone number was found.
+	var planned []reminder
+	for _, r := range reminders {
+		event, num := r.Event, r.Recipient
+		if r.Skip != "" {
+			metrics.Skipped++
+			explainDecision(event, r.Skip, r.Detail)
 			continue
 		}
 
-		key := eventMessageKey(event)
-		if store.Exists(key) {
-			// Skip messages which where already sent.
+		if *seedOnly {
+			// Establish a baseline: record the reminder without sending it.
+			fmt.Fprintf(os.Stdout, "seed %s %s\n", event.Summary, num)
+			if *dryRun {
+				continue
+			}
+
+			if err := store.Mark(eventMessageKey(event)); err != nil {
+				return err
+			}
+			explainDecision(event, "seeded", num)
 			continue
 		}
 
-		// Generate a new message
-		var buf bytes.Buffer
-		if err := msgTmpl.Execute(&buf, event); err != nil {
+		if err := printReminder(os.Stdout, event, num, r.Message); err != nil {
+			return err
+		}
+		planned = append(planned, r)
+	}
+
+	if *confirm && !*dryRun && !*smsSandbox && len(planned) > 0 {
+		ok, err := confirmPlan(os.Stdin, os.Stderr, len(planned))
+		if err != nil {
 			return err
 		}
-		msg := buf.String()
-		fmt.Fprintf(os.Stdout, "remind %s %s: %s\n", event.Summary, num, msg)
-		if *dryRun {
+		if !ok {
+			*dryRun = true
+		}
+	}
+
+	err = apply(ctx, planned, applyConfig{
+		Now:         now,
+		Location:    loc,
+		Store:       store,
+		Audit:       audit,
+		Accounts:    accounts,
+		Senders:     calendarSenders,
+		DeliverAt:   deliveryClock,
+		Quiet:       quiet,
+		Metrics:     &metrics,
+		DryRun:      *dryRun,
+		Sandbox:     *smsSandbox,
+		Concurrency: *concurrency,
+		MaxSMS:      *maxSMS,
+		AuditFull:   *auditFull,
+	})
+
+	if *resume && *icsFile == "" && !*dryRun {
+		if cursorErr := saveCursor(store, query.Start, query.End, resumed, reminders, err == nil); cursorErr != nil {
+			err = errors.Join(err, cursorErr)
+		}
+	}
+
+	// A run stopped by the -max-sms fuse or a failed mark leaves the
+	// rest of the state as it is.
+	if errors.Is(err, errStopped) {
+		return err
+	}
+
+	if *stateTTL > 0 && !*dryRun {
+		n, pruneErr := store.Prune(*stateTTL)
+		if pruneErr != nil {
+			return errors.Join(err, pruneErr)
+		}
+		if n > 0 {
+			slog.Info("pruned sent reminders", "count", n, "older-than", *stateTTL)
+		}
+	}
+
+	return err
+}
+
+// parseCalendarTemplates parses the templates per calendar name and
+// checks them for an event on day. The returned map is keyed by calendarKey.
+func parseCalendarTemplates(templates map[string]string, day time.Time) (map[string]*template.Template, error) {
+	out := map[string]*template.Template{}
+	for name, text := range templates {
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("template of calendar %q: %w", name, err)
+		}
+
+		if _, err := checkTemplate(tmpl, day); err != nil {
+			return nil, fmt.Errorf("template of calendar %q: %w", name, err)
+		}
+		out[calendarKey(name)] = tmpl
+	}
+	return out, nil
+}
+
+// parseCalendarSenders validates the SMS sender names of the calendars.
+func parseCalendarSenders(senders map[string]string) (map[string]string, error) {
+	out := map[string]string{}
+	for name, sender := range senders {
+		if err := aspsms.ValidateOriginator(sender); err != nil {
+			return nil, fmt.Errorf("sender of calendar %q: %w", name, err)
+		}
+		out[calendarKey(name)] = sender
+	}
+	return out, nil
+}
+
+// calendarKey returns the key under which calendar names are matched (case-insensitive).
+func calendarKey(name string) string {
+	return strings.ToLower(normalizeCalendarName(name))
+}
+
+// calendarTemplate returns the template of the calendar of the event,
+// or def if the calendar has no template.
+func calendarTemplate(event cal.Event, templates map[string]*template.Template, def *template.Template) *template.Template {
+	if tmpl, ok := templates[calendarKey(event.CalendarName)]; ok {
+		return tmpl
+	}
+	return def
+}
+
+// regionTemplates contains the message templates by language tag,
+// e.g. de-AT, de-DE or en.
+type regionTemplates struct {
+	// byRegion contains the templates of tags with a region (de-AT).
+	byRegion map[string]*template.Template
+	// byLanguage contains the templates of tags without a region (en).
+	byLanguage map[string]*template.Template
+}
+
+// parseRegionTemplates parses the templates by language tag and
+// checks them for an event on day.
+func parseRegionTemplates(templates map[string]string, day time.Time) (regionTemplates, error) {
+	out := regionTemplates{
+		byRegion:   map[string]*template.Template{},
+		byLanguage: map[string]*template.Template{},
+	}
+	for name, text := range templates {
+		tag, err := language.Parse(name)
+		if err != nil {
+			return out, fmt.Errorf("invalid language tag %q: %w", name, err)
+		}
+
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return out, fmt.Errorf("template of %q: %w", name, err)
+		}
+		if _, err := checkTemplate(tmpl, day); err != nil {
+			return out, fmt.Errorf("template of %q: %w", name, err)
+		}
+
+		if region, conf := tag.Region(); conf == language.Exact {
+			if _, ok := out.byRegion[region.String()]; ok {
+				return out, fmt.Errorf("more than one template for region %s", region)
+			}
+			out.byRegion[region.String()] = tmpl
+			continue
+		}
+
+		base, _ := tag.Base()
+		out.byLanguage[base.String()] = tmpl
+	}
+	return out, nil
+}
+
+// template returns the template for the region of the phone number num.
+// A template for the region (de-AT) takes precedence over a template for
+// the main language of the region (de). Otherwise def is returned.
+func (t regionTemplates) template(num string, def *template.Template) *template.Template {
+	region := cal.PhoneNumberRegion(num)
+	if region == "" {
+		return def
+	}
+
+	if tmpl, ok := t.byRegion[region]; ok {
+		return tmpl
+	}
+
+	base, _ := language.Make("und-" + region).Base()
+	if tmpl, ok := t.byLanguage[base.String()]; ok {
+		return tmpl
+	}
+	return def
+}
+
+// eventTemplate returns the message template for an event.
+// Events can bring their own template via the X-SMS-TEMPLATE property,
+// otherwise the default template is used.
+func eventTemplate(event cal.Event, def *template.Template) *template.Template {
+	if event.Template == "" {
+		return def
+	}
+
+	tmpl, err := template.New(event.UID).Parse(event.Template)
+	if err != nil {
+		slog.Warn("ignoring invalid X-SMS-TEMPLATE", "uid", event.UID, "err", err)
+		return def
+	}
+	return tmpl
+}
+
+// attendeesInRange returns true if n is within [min, max].
+// A max of 0 means there is no upper limit.
+func attendeesInRange(n, min, max int) bool {
+	if n < min {
+		return false
+	}
+	return max <= 0 || n <= max
+}
+
+// reminder is the decision for an event in range.
+type reminder struct {
+	Event     cal.Event
+	Recipient string
+	// Message is the rendered text, set once the reminder is planned.
+	Message string
+
+	// Skip is the decision (e.g. skipped-no-number) if no reminder is sent
+	// for the event, and Detail explains it.
+	Skip   string
+	Detail string
+}
+
+// clock is a time of day.
+type clock struct {
+	Hour   int
+	Minute int
+}
+
+// parseClock parses a time of day like 09:30. It returns nil for an empty string.
+func parseClock(s string) (*clock, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return nil, err
+	}
+	return &clock{Hour: t.Hour(), Minute: t.Minute()}, nil
+}
+
+// deliveryTime returns the time at which the reminder for the event should
+// be delivered: at c on the day of the event in the timezone of the recipient,
+// or in loc (-timezone) if the timezone of the recipient is unknown.
+// It returns the zero time if that is not between now and the event start.
+func deliveryTime(event cal.Event, num string, c clock, now time.Time, loc *time.Location) time.Time {
+	loc = cal.RecipientLocation(event, num, loc)
+	day := event.Start.In(loc)
+	at := time.Date(day.Year(), day.Month(), day.Day(), c.Hour, c.Minute, 0, 0, loc)
+	if !at.After(now) || !at.Before(event.Start) {
+		return time.Time{}
+	}
+	return at
+}
+
+// plannedReminder is printed for every reminder with -output json.
+type plannedReminder struct {
+	UID       string    `json:"uid"`
+	Start     time.Time `json:"start"`
+	Recipient string    `json:"recipient"`
+	Message   string    `json:"message"`
+	Calendar  string    `json:"calendar,omitempty"`
+}
+
+// printReminder prints a reminder before it is sent in the format of the -output flag.
+func printReminder(w io.Writer, event cal.Event, num, msg string) error {
+	if *output != "json" {
+		_, err := fmt.Fprintf(w, "remind %s %s: %s\n", event.Summary, num, msg)
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(plannedReminder{
+		UID:       event.UID,
+		Start:     event.Start,
+		Recipient: num,
+		Message:   msg,
+		Calendar:  event.CalendarName,
+	})
+}
+
+// duplicateRecipients returns the recipients of at least threshold distinct events
+// together with the UIDs of those events. A threshold < 2 disables the check.
+func duplicateRecipients(reminders []reminder, threshold int) map[string][]string {
+	out := map[string][]string{}
+	if threshold < 2 {
+		return out
+	}
+
+	uids := map[string][]string{}
+	for _, r := range reminders {
+		if !slices.Contains(uids[r.Recipient], r.Event.UID) {
+			uids[r.Recipient] = append(uids[r.Recipient], r.Event.UID)
+		}
+	}
+
+	for num, list := range uids {
+		if len(list) >= threshold {
+			out[num] = list
+		}
+	}
+	return out
+}
+
+// resetStore backs up sent.json to a timestamped file and clears it.
+// Without confirm, it only reports what would be done.
+func resetStore(confirm bool) error {
+	if *storeType != "file" {
+		return fmt.Errorf("-reset-state is not supported with -store %s", *storeType)
+	}
+
+	lock, err := idempotency.AcquireLockWait(filepath.Join(*stateDir, "simremind.lock"), 1*time.Minute, *lockWait)
+	if err != nil {
+		return fmt.Errorf("reset state: %w", err)
+	}
+	defer lock.Release()
+
+	path := filepath.Join(*stateDir, "sent.json")
+	store, err := idempotency.Open(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	keys, err := store.Keys()
+	if err != nil {
+		return err
+	}
+	n := len(keys)
+	backup := fmt.Sprintf("%s.%s.bak", path, time.Now().UTC().Format("20060102T150405Z"))
+	if !confirm {
+		fmt.Fprintf(os.Stdout, "would back up %d entries to %s and clear %s (use -yes to proceed)\n", n, backup, path)
+		return nil
+	}
+
+	if err := store.Backup(backup); err != nil {
+		return fmt.Errorf("backup state: %w", err)
+	}
+
+	if err := store.Clear(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "backed up %d entries to %s and cleared %s\n", n, backup, path)
+	return nil
+}
+
+// modifiedSinceSent returns true if the event was modified after
+// its reminder was sent. The time of sending is the time the reminder
+// was marked in the store, so every correction moves it forward and
+// a reminder is only corrected once per modification.
+func modifiedSinceSent(store idempotency.StateStore, event cal.Event) (bool, error) {
+	if event.Modified.IsZero() {
+		return false, nil
+	}
+
+	sentAt, ok, err := store.Lookup(eventMessageKey(event))
+	if !ok || err != nil {
+		return false, err
+	}
+	return event.Modified.After(sentAt), nil
+}
+
+// markSent records the sent reminder under key. With -store-messages the
+// recipient and the message are recorded too, if the store supports it.
+func markSent(store idempotency.StateStore, key, num, msg string) error {
+	if es, ok := store.(idempotency.EntryStore); ok && *storeMessages {
+		return es.MarkEntry(key, idempotency.Entry{Recipient: num, Message: msg})
+	}
+	return store.Mark(key)
+}
+
+// openStore opens the store selected by the -store flag.
+func openStore() (idempotency.StateStore, error) {
+	switch *storeSync {
+	case "each":
+	case "end":
+		if *storeType != "file" {
+			return nil, usageError(fmt.Errorf("-store-sync end is not supported with -store %s", *storeType))
+		}
+	default:
+		return nil, usageError(fmt.Errorf("unknown -store-sync %q", *storeSync))
+	}
+	if *storeMessages && *storeType == "sqlite" {
+		return nil, usageError(errors.New("-store-messages is not supported with -store sqlite"))
+	}
+
+	switch *storeType {
+	case "file":
+		store, err := idempotency.Open(filepath.Join(*stateDir, "sent.json"))
+		if err != nil {
+			return nil, err
+		}
+		if *storeSync == "end" {
+			store.DeferWrites()
+		}
+		return store, nil
+	case "sqlite":
+		store, err := idempotency.OpenSQLite(filepath.Join(*stateDir, "sent.db"))
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "memory":
+		return idempotency.NewMemoryStore(), nil
+	default:
+		return nil, usageError(fmt.Errorf("unknown store %q", *storeType))
+	}
+}
+
+type Query struct {
+	Endpoint  string
+	AppleId   string
+	Password  string
+	Start     time.Time
+	End       time.Time
+	Calendars []string
+
+	// ExcludeCalendars are skipped, also if they are in Calendars.
+	ExcludeCalendars []string
+
+	// CalendarURL is the URL of a calendar collection.
+	// If set, the calendar discovery is skipped.
+	CalendarURL string
+
+	// Cache stores the calendar data of previous runs.
+	// If set, only changed resources are downloaded.
+	Cache *calendarCache
+
+	// Sync enables incremental fetches with sync-collection (RFC 6578).
+	// It requires a Cache.
+	Sync bool
+
+	// Headers are added to every CalDav request.
+	Headers http.Header
+
+	// Timeout limits every CalDav request (default 30s).
+	Timeout time.Duration
+
+	// Account is the name of the CalDav account (see AccountConfig).
+	Account string
+
+	// SkipCalendars contains the URLs of calendars which are not queried (see -resume).
+	SkipCalendars map[string]bool
+
+	// TLS configures the connections to the CalDav server,
+	// e.g. with a client certificate. Nil uses the defaults.
+	TLS *tls.Config
+
+	// Proxy returns the proxy for a CalDav request.
+	// Nil uses the proxy configured by the environment.
+	Proxy func(*http.Request) (*url.URL, error)
+}
+
+func execute(ctx context.Context, query Query, defaultTZ *time.Location) ([]cal.Event, error) {
+	if defaultTZ == nil {
+		defaultTZ = time.Local
+	}
+
+	httpClient := newCalDAVClient(query)
+
+	var calendars []CalendarInfo
+	if query.CalendarURL != "" {
+		u, err := directCalendarURL(query.CalendarURL)
+		if err != nil {
+			return nil, err
+		}
+		calendars = []CalendarInfo{{URL: u}}
+	} else {
+		discovered, err := discoverCalendars(ctx, httpClient, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cal := range discovered {
+			slog.Debug("calendar discovered", "calendar", cal.DisplayName, "url", cal.URL.String())
+			if !query.includesCalendar(cal.DisplayName) {
+				if *explain {
+					fmt.Fprintf(os.Stdout, "explain skipped-filtered-calendar %q\n", cal.DisplayName)
+				}
+				continue
+			}
+			calendars = append(calendars, cal)
+		}
+	}
+
+	start := query.Start
+	end := query.End
+
+	events := []cal.Event{}
+	for _, calendar := range calendars {
+		if query.SkipCalendars[calendar.URL.String()] {
+			slog.Debug("calendar done by the interrupted run", "calendar", calendar.DisplayName)
 			continue
 		}
 
-		if err := client.SendSimpleTextSMS(num, msg); err != nil {
-			return err
-		}
+		icsBlobs, err := calendarData(ctx, httpClient, query, calendar.URL)
+		if err != nil {
+			slog.Warn("calendar query failed", "calendar", calendar.DisplayName, "err", err)
+			continue
+		}
+		slog.Debug("calendar queried", "calendar", calendar.DisplayName, "resources", len(icsBlobs))
+		if len(icsBlobs) == 0 {
+			continue
+		}
+
+		for _, icsText := range icsBlobs {
+			// Parse returned VCALENDAR text
+			evs, perr := cal.ParseICSInRange(strings.NewReader(icsText), defaultTZ, start, end, cal.Options{IncludeTodos: *includeTodos})
+			if perr != nil {
+				slog.Warn("ignoring invalid calendar data", "calendar", calendar.DisplayName, "err", perr)
+				continue
+			}
+			if query.Sync {
+				// A sync returns the whole calendar, not only the range.
+				evs = eventsInRange(evs, start, end)
+			}
+
+			for i := range evs {
+				evs[i].Account = query.Account
+				evs[i].CalendarName = calendar.DisplayName
+				evs[i].CalendarURL = calendar.URL.String()
+			}
+
+			events = append(events, evs...)
+		}
+	}
+
+	return events, nil
+}
+
+// readICSFile returns the events of the iCalendar file at path in the range [from, to).
+func readICSFile(path string, defaultTZ *time.Location, from, to time.Time) ([]cal.Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events, err := cal.ParseICSInRange(f, defaultTZ, from, to, cal.Options{IncludeTodos: *includeTodos})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return eventsInRange(events, from, to), nil
+}
 
-		err = store.Mark(key)
-		if err != nil {
-			return err
+// eventsInRange returns the events which overlap [from, to), see cal.Event.Overlaps.
+func eventsInRange(events []cal.Event, from, to time.Time) []cal.Event {
+	var out []cal.Event
+	for _, e := range events {
+		if e.Overlaps(from, to) {
+			out = append(out, e)
 		}
 	}
+	return out
+}
 
-	return nil
+// includesCalendar returns true if the calendar with the name should be queried.
+func (query Query) includesCalendar(name string) bool {
+	if containsCalendar(query.ExcludeCalendars, name) {
+		return false
+	}
+	return len(query.Calendars) == 0 || containsCalendar(query.Calendars, name)
 }
 
-type Query struct {
-	Endpoint  string
-	AppleId   string
-	Password  string
-	Start     time.Time
-	End       time.Time
-	Calendars []string
+// containsCalendar returns true if names contains name (case-insensitive).
+func containsCalendar(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(name, n) {
+			return true
+		}
+	}
+	return false
 }
 
-func execute(ctx context.Context, query Query, defaultTZ *time.Location) ([]cal.Event, error) {
-	if defaultTZ == nil {
-		defaultTZ = time.Local
+// newCalDAVClient returns the http client for CalDav requests.
+func newCalDAVClient(query Query) *http.Client {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = query.TLS
+	if query.Proxy != nil {
+		base.Proxy = query.Proxy
+	}
+	transport := newDigestTransport(&headerTransport{header: query.Headers, base: base})
+
+	timeout := query.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
 	}
 
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// Preserve Authorization across redirects (iCloud often redirects to pXX host).
 			if len(via) > 0 {
@@ -186,12 +1281,14 @@ func execute(ctx context.Context, query Query, defaultTZ *time.Location) ([]cal.
 			return nil
 		},
 	}
+}
 
-	endpoint := query.Endpoint
+// discoverCalendars returns all calendars of the user.
+func discoverCalendars(ctx context.Context, httpClient *http.Client, query Query) ([]CalendarInfo, error) {
 	appleID := query.AppleId
 	appPassword := query.Password
 
-	baseURL, err := url.Parse(endpoint)
+	baseURL, err := url.Parse(query.Endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("invalid endpoint: %w", err)
 	}
@@ -208,71 +1305,33 @@ func execute(ctx context.Context, query Query, defaultTZ *time.Location) ([]cal.
 	if err != nil {
 		return nil, fmt.Errorf("calendar-home-set: %w", err)
 	}
-	homeSetURL := resolveHref(principalURL, homeSetHref)
+	homeSetURL := collectionURL(resolveHref(principalURL, homeSetHref))
 
 	// 3) List calendars (Depth:1) under home set
 	calendars, err := propfindCalendars(ctx, httpClient, homeSetURL, appleID, appPassword)
 	if err != nil {
 		return nil, fmt.Errorf("list calendars: %w", err)
 	}
+	return calendars, nil
+}
 
-	start := query.Start
-	end := query.End
-
-	events := []cal.Event{}
-	for _, cal := range calendars {
-		if len(query.Calendars) > 0 {
-			// Filter by name
-			var found = false
-			for _, name := range query.Calendars {
-				if strings.EqualFold(cal.DisplayName, name) {
-					found = true
-					break
-				}
-			}
-			if !found {
-				continue
-			}
-		}
-
-		icsBlobs, err := reportCalendarQuery(ctx, httpClient, cal.URL, appleID, appPassword, start, end)
-		if err != nil {
-			continue
-		}
-		if len(icsBlobs) == 0 {
-			continue
-		}
-
-		for _, icsText := range icsBlobs {
-			// Parse returned VCALENDAR text
-			dec := ical.NewDecoder(strings.NewReader(icsText))
-			for {
-				calObj, derr := dec.Decode()
-				if derr == io.EOF {
-					break
-				}
-				if derr != nil {
-					break
-				}
-
-				evs, perr := eventsFromCalendar(calObj, defaultTZ)
-				if perr != nil {
-					break
-				}
-
-				events = append(events, evs...)
-			}
-		}
+// directCalendarURL parses the URL of a calendar collection.
+func directCalendarURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar url: %w", err)
 	}
-
-	return events, nil
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("invalid calendar url %q: not absolute", s)
+	}
+	return collectionURL(u), nil
 }
 
 func parseCalendarNames(s string) []string {
 	parts := strings.Split(s, ",")
 	out := make([]string, 0, len(parts))
 	for _, p := range parts {
-		p = strings.TrimSpace(p)
+		p = normalizeCalendarName(p)
 		if p != "" {
 			out = append(out, p)
 		}
@@ -280,11 +1339,71 @@ func parseCalendarNames(s string) []string {
 	return out
 }
 
+// normalizeCalendarName returns the NFC normalized name without zero-width
+// characters and with whitespace collapsed, so that visually identical
+// names are equal.
+func normalizeCalendarName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+			return -1
+		}
+		return r
+	}, norm.NFC.String(name))
+
+	return strings.Join(strings.Fields(name), " ")
+}
+
 // Returns the time marking the start of a day.
 func startOfDay(d time.Time, loc *time.Location) time.Time {
 	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc)
 }
 
+// queryRange returns the range of events of the run. This is the day
+// at -offset unless -since or -until override the bounds.
+func queryRange(now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	day := now.AddDate(0, 0, *offset)
+	start, end := startOfDay(day, loc), endOfDay(day, loc)
+
+	if *since != "" {
+		t, err := parseRangeTime(*since, loc, false)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -since: %w", err)
+		}
+		start = t
+	}
+
+	if *until != "" {
+		t, err := parseRangeTime(*until, loc, true)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -until: %w", err)
+		}
+		end = t
+	}
+
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("empty range from %s to %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
+
+// parseRangeTime parses a time in RFC3339 or a date in loc.
+// A date is the start of the day, or its end if isEnd is true.
+func parseRangeTime(s string, loc *time.Location, isEnd bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseInLocation(time.DateOnly, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC3339 nor YYYY-MM-DD", s)
+	}
+	if isEnd {
+		return endOfDay(d, loc), nil
+	}
+	return d, nil
+}
+
 // Returns the time marking the end of a day.
 func endOfDay(d time.Time, loc *time.Location) time.Time {
 	start := startOfDay(d, loc)
@@ -292,50 +1411,214 @@ func endOfDay(d time.Time, loc *time.Location) time.Time {
 }
 
 // Returns the UUID of a message related to an event.
+// If a template version is set, it is appended to the key as "|v-<version>".
 func eventMessageKey(event cal.Event) string {
-	return event.UID + "|" + event.Start.Format(time.RFC3339) + fmt.Sprintf("|T-%dd", *offset)
+	key := eventKeyPrefix(event)
+	if *templateVersion != "" {
+		key += "|v-" + *templateVersion
+	}
+	return key
 }
 
-func doDAV(ctx context.Context, c *http.Client, method string, u *url.URL, user, pass string, depth string, body []byte) ([]byte, http.Header, int, error) {
+// Returns the part of the message key which is independent of the template version.
+// The UID of an event of a named account is prefixed with "<account>/".
+func eventKeyPrefix(event cal.Event) string {
+	uid := event.UID
+	if event.Account != "" {
+		uid = event.Account + "/" + uid
+	}
+	return uid + "|" + event.Start.Format(time.RFC3339) + fmt.Sprintf("|T-%dd", *offset)
+}
+
+// sentAt returns the time at which the reminder for the event was sent.
+// A reminder sent with a different template version only counts
+// as sent if -resend-template is not set.
+func sentAt(store idempotency.StateStore, event cal.Event) (time.Time, bool, error) {
+	if t, ok, err := store.Lookup(eventMessageKey(event)); ok || err != nil {
+		return t, ok, err
+	}
+
+	if *resendTemplate {
+		return time.Time{}, false, nil
+	}
+
+	prefix := eventKeyPrefix(event)
+	keys, err := store.KeysByPrefix(prefix)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, key := range keys {
+		if key == prefix || strings.HasPrefix(key, prefix+"|v-") {
+			return store.Lookup(key)
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// explainDecision prints what happened to an event with -explain.
+func explainDecision(event cal.Event, decision, detail string) {
+	attrs := []any{"decision", decision, "uid", event.UID, "detail", detail}
+	if len(event.Attendees) > 0 {
+		attrs = append(attrs, "attendees", attendeeStatus(event))
+	}
+	slog.Debug("decision", attrs...)
+	if !*explain {
+		return
+	}
+
+	line := fmt.Sprintf("explain %s %s %q", decision, event.UID, event.Summary)
+	if detail != "" {
+		line += ": " + detail
+	}
+	fmt.Fprintln(os.Stdout, line)
+}
+
+// attendeeStatus lists the attendees of the event with their
+// participation status, e.g. "tel:+436601234567 (DECLINED)".
+func attendeeStatus(event cal.Event) string {
+	var out []string
+	for _, attendee := range event.Attendees {
+		out = append(out, fmt.Sprintf("%s (%s)", attendee, event.AttendeePartStat(attendee)))
+	}
+	return strings.Join(out, ", ")
+}
+
+// headerList is a repeatable flag of "Name: Value" headers.
+type headerList http.Header
+
+func (l headerList) String() string {
+	var out []string
+	for name, values := range l {
+		for _, value := range values {
+			out = append(out, name+": "+value)
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+func (l headerList) Set(s string) error {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("invalid header %q (want \"Name: Value\")", s)
+	}
+	http.Header(l).Add(name, strings.TrimSpace(value))
+	return nil
+}
+
+// headerTransport adds a fixed set of headers to every request.
+// Because redirects go through the transport too, the headers
+// are also sent to the host a request is redirected to.
+type headerTransport struct {
+	header http.Header
+	base   http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if len(t.header) == 0 {
+		return base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request.
+	req = req.Clone(req.Context())
+	for name, values := range t.header {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return base.RoundTrip(req)
+}
+
+// openDAV sends a DAV request. The body of the returned response is
+// decompressed and must be closed, which also releases the deadline
+// of the request.
+func openDAV(ctx context.Context, c *http.Client, method string, u *url.URL, user, pass string, depth string, body []byte) (*http.Response, error) {
+	// The deadline also covers reading the body of a hung server.
+	cancel := func() {}
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+
 	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
 	if err != nil {
-		return nil, nil, 0, err
+		cancel()
+		return nil, err
 	}
-	req.SetBasicAuth(user, pass)
 	req.Header.Set("Accept", "application/xml, text/xml, */*")
 	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
 	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("User-Agent", *userAgent)
 	if depth != "" {
 		req.Header.Set("Depth", depth)
 	}
+	// The digestTransport of the client answers Digest challenges with
+	// these credentials, see -auth-mode.
+	req.SetBasicAuth(user, pass)
 
 	resp, err := c.Do(req)
 	if err != nil {
-		return nil, nil, 0, err
+		cancel()
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var r io.Reader = resp.Body
+	respBody := &davBody{Reader: resp.Body, closers: []io.Closer{resp.Body}, cancel: cancel}
 	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
 		gr, err := gzip.NewReader(resp.Body)
 		if err != nil {
-			return nil, resp.Header, resp.StatusCode, err
+			respBody.Close()
+			return nil, err
 		}
-		defer gr.Close()
-		r = gr
+		respBody.Reader = gr
+		respBody.closers = append([]io.Closer{gr}, respBody.closers...)
 	}
+	resp.Body = respBody
+	return resp, nil
+}
 
-	b, err := io.ReadAll(r)
-	if err != nil {
-		return nil, resp.Header, resp.StatusCode, err
+// davBody is the body of a response of openDAV.
+type davBody struct {
+	io.Reader
+	closers []io.Closer
+	cancel  context.CancelFunc
+}
+
+func (b *davBody) Close() error {
+	defer b.cancel()
+
+	var errs []error
+	for _, c := range b.closers {
+		errs = append(errs, c.Close())
 	}
+	return errors.Join(errs...)
+}
 
+// davStatusError returns an error if resp has no success status.
+func davStatusError(method string, u *url.URL, resp *http.Response) error {
 	// WebDAV uses 207 Multi-Status for PROPFIND/REPORT (still success).
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return b, resp.Header, resp.StatusCode, fmt.Errorf("%s %s -> %s", method, u.String(), resp.Status)
+		return fmt.Errorf("%s %s -> %s", method, u.String(), resp.Status)
 	}
+	return nil
+}
+
+func doDAV(ctx context.Context, c *http.Client, method string, u *url.URL, user, pass string, depth string, body []byte) ([]byte, http.Header, int, error) {
+	resp, err := openDAV(ctx, c, method, u, user, pass, depth, body)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer resp.Body.Close()
 
-	return b, resp.Header, resp.StatusCode, nil
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.Header, resp.StatusCode, err
+	}
+
+	return b, resp.Header, resp.StatusCode, davStatusError(method, u, resp)
 }
 
 func resolveHref(base *url.URL, href string) *url.URL {
@@ -348,6 +1631,22 @@ func resolveHref(base *url.URL, href string) *url.URL {
 	return base.ResolveReference(u)
 }
 
+// collectionURL returns u with a trailing slash.
+// WebDAV collections are addressed with a trailing slash
+// and some servers reject requests without it.
+func collectionURL(u *url.URL) *url.URL {
+	if strings.HasSuffix(u.Path, "/") {
+		return u
+	}
+
+	c := *u
+	c.Path += "/"
+	if c.RawPath != "" {
+		c.RawPath += "/"
+	}
+	return &c
+}
+
 type multistatus struct {
 	XMLName   xml.Name `xml:"multistatus"`
 	Responses []msResp `xml:"response"`
@@ -452,8 +1751,8 @@ func propfindCalendars(ctx context.Context, c *http.Client, home *url.URL, user,
 		for _, ps := range r.Propstats {
 			if ps.Prop.ResourceType.Calendar != nil {
 				out = append(out, CalendarInfo{
-					DisplayName: strings.TrimSpace(ps.Prop.DisplayName),
-					URL:         resolveHref(home, r.Href),
+					DisplayName: normalizeCalendarName(ps.Prop.DisplayName),
+					URL:         collectionURL(resolveHref(home, r.Href)),
 				})
 				break
 			}
@@ -462,183 +1761,236 @@ func propfindCalendars(ctx context.Context, c *http.Client, home *url.URL, user,
 	return out, nil
 }
 
-// 4) REPORT calendar-query: fetch calendar-data for VEVENTs in range
+// 4) REPORT calendar-query: fetch calendar-data for VEVENTs (and VTODOs with -include-todos) in range
 func reportCalendarQuery(ctx context.Context, c *http.Client, calURL *url.URL, user, pass string, start, end time.Time) ([]string, error) {
+	resources, err := reportCalendarResources(ctx, c, calURL, user, pass, start, end, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, r := range resources {
+		if r.Data != "" {
+			out = append(out, r.Data)
+		}
+	}
+	return out, nil
+}
+
+// calendarResource is a calendar object resource returned by a REPORT.
+type calendarResource struct {
+	Href string
+	ETag string
+	Data string
+}
+
+// reportCalendarResources returns the resources with events in the range.
+// The calendar data is only included if withData is true.
+// With -include-todos, resources with tasks in the range are included too.
+func reportCalendarResources(ctx context.Context, c *http.Client, calURL *url.URL, user, pass string, start, end time.Time, withData bool) ([]calendarResource, error) {
+	comps := []string{"VEVENT"}
+	if *includeTodos {
+		comps = append(comps, "VTODO")
+	}
+
+	// Sibling comp-filters must all match, which is why every
+	// component is queried separately.
+	var out []calendarResource
+	seen := map[string]bool{}
+	for _, comp := range comps {
+		resources, err := reportComponentResources(ctx, c, calURL, user, pass, comp, start, end, withData)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range resources {
+			if !seen[r.Href] {
+				seen[r.Href] = true
+				out = append(out, r)
+			}
+		}
+	}
+	return out, nil
+}
+
+// reportComponentResources returns the resources with components of type comp in the range.
+func reportComponentResources(ctx context.Context, c *http.Client, calURL *url.URL, user, pass string, comp string, start, end time.Time, withData bool) ([]calendarResource, error) {
 	startUTC := start.UTC().Format("20060102T150405Z")
 	endUTC := end.UTC().Format("20060102T150405Z")
 
+	var dataProp string
+	if withData {
+		dataProp = "\n    <c:calendar-data/>"
+	}
+
 	body := []byte(fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
 <c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
   <d:prop>
-    <d:getetag/>
-    <c:calendar-data/>
+    <d:getetag/>%s
   </d:prop>
   <c:filter>
     <c:comp-filter name="VCALENDAR">
-      <c:comp-filter name="VEVENT">
+      <c:comp-filter name="%s">
         <c:time-range start="%s" end="%s"/>
       </c:comp-filter>
     </c:comp-filter>
   </c:filter>
-</c:calendar-query>`, startUTC, endUTC))
+</c:calendar-query>`, dataProp, comp, startUTC, endUTC))
 
-	b, _, _, err := doDAV(ctx, c, "REPORT", calURL, user, pass, "1", body)
-	if err != nil {
-		return nil, fmt.Errorf("%w\n%s", err, string(b))
-	}
+	return reportResources(ctx, c, calURL, user, pass, body)
+}
 
-	// Parse multistatus and extract <calendar-data>
-	type reportMS struct {
-		Responses []struct {
-			Propstats []struct {
-				Prop struct {
-					CalendarData string `xml:"calendar-data"`
-				} `xml:"prop"`
-			} `xml:"propstat"`
-		} `xml:"response"`
+// multigetCalendarResources downloads the resources at hrefs with a calendar-multiget REPORT.
+func multigetCalendarResources(ctx context.Context, c *http.Client, calURL *url.URL, user, pass string, hrefs []string) ([]calendarResource, error) {
+	var buf bytes.Buffer
+	for _, href := range hrefs {
+		buf.WriteString("  <d:href>")
+		xml.EscapeText(&buf, []byte(href))
+		buf.WriteString("</d:href>\n")
 	}
-	var ms reportMS
-	if err := xml.Unmarshal(b, &ms); err != nil {
+
+	body := []byte(fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop>
+    <d:getetag/>
+    <c:calendar-data/>
+  </d:prop>
+%s</c:calendar-multiget>`, buf.String()))
+
+	return reportResources(ctx, c, calURL, user, pass, body)
+}
+
+// reportResources sends a REPORT and decodes the resources of the
+// multistatus response while it is read.
+func reportResources(ctx context.Context, c *http.Client, calURL *url.URL, user, pass string, body []byte) ([]calendarResource, error) {
+	resp, err := openDAV(ctx, c, "REPORT", calURL, user, pass, "1", body)
+	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	var out []string
-	for _, r := range ms.Responses {
-		for _, ps := range r.Propstats {
-			cd := strings.TrimSpace(ps.Prop.CalendarData)
-			if cd != "" {
-				out = append(out, cd)
-			}
-		}
+	if err := davStatusError("REPORT", calURL, resp); err != nil {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%w\n%s", err, string(b))
 	}
-	return out, nil
+
+	var out []calendarResource
+	err = decodeCalendarResources(resp.Body, func(r calendarResource) {
+		out = append(out, r)
+	})
+	return out, err
 }
 
-func eventsFromCalendar(c *ical.Calendar, defaultTZ *time.Location) ([]cal.Event, error) {
-	if c == nil {
-		return nil, fmt.Errorf("nil calendar")
-	}
-	if defaultTZ == nil {
-		defaultTZ = time.Local
+// decodeCalendarResources calls fn for every response of the multistatus
+// read from r. Responses are decoded one at a time, so that the raw body
+// of the multistatus isn't buffered; the decoded resources, including
+// their calendar data, are still collected by the caller.
+func decodeCalendarResources(r io.Reader, fn func(calendarResource)) error {
+	type reportResponse struct {
+		Href string `xml:"href"`
+		// Status is only set for responses without properties.
+		Status    string `xml:"status"`
+		Propstats []struct {
+			Prop struct {
+				ETag         string `xml:"getetag"`
+				CalendarData string `xml:"calendar-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
 	}
 
-	var out []cal.Event
-	for _, c := range c.Children {
-		if c == nil || c.Name != "VEVENT" {
+	dec := xml.NewDecoder(r)
+	var root bool
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && root {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		root = true
+		if start.Name.Local != "response" {
 			continue
 		}
 
-		uid := firstPropValue(c.Props, "UID")
-		if uid == "" {
-			uid = "(missing-uid)"
+		var resp reportResponse
+		if err := dec.DecodeElement(&resp, &start); err != nil {
+			return err
 		}
 
-		dtStart := firstProp(c.Props, "DTSTART")
-		if dtStart == nil {
+		// Servers which limit the number of results mark the
+		// request URI with 507 (RFC 4918, section 11.5).
+		if strings.Contains(resp.Status, " 507 ") {
+			slog.Warn("the server truncated the results of the calendar, some events are missing", "href", strings.TrimSpace(resp.Href))
 			continue
 		}
-		start, startIsDate, err := parseICalDateTime(dtStart, defaultTZ)
-		if err != nil {
-			return nil, fmt.Errorf("parse DTSTART for %s: %w", uid, err)
-		}
 
-		var end time.Time
-		if dtEnd := firstProp(c.Props, "DTEND"); dtEnd != nil {
-			end, _, err = parseICalDateTime(dtEnd, defaultTZ)
-			if err != nil {
-				return nil, fmt.Errorf("parse DTEND for %s: %w", uid, err)
+		res := calendarResource{Href: strings.TrimSpace(resp.Href)}
+		for _, ps := range resp.Propstats {
+			if etag := strings.TrimSpace(ps.Prop.ETag); etag != "" {
+				res.ETag = etag
 			}
-		} else if startIsDate {
-			end = start.Add(24 * time.Hour)
-		} else {
-			end = start
-		}
-
-		out = append(out, cal.Event{
-			UID:         uid,
-			Start:       start,
-			End:         end,
-			Summary:     firstPropValue(c.Props, "SUMMARY"),
-			Description: firstPropValue(c.Props, "DESCRIPTION"),
-			Comment:     firstPropValue(c.Props, "COMMENT"),
-		})
+			if cd := strings.TrimSpace(ps.Prop.CalendarData); cd != "" {
+				res.Data = cd
+			}
+		}
+		fn(res)
 	}
-	return out, nil
 }
 
-func firstProp(props ical.Props, name string) *ical.Prop {
-	ps := props[name]
-	if len(ps) == 0 {
-		return nil
+// calendarData returns the calendar data of the resources with events in the
+// range of the query. With a cache, only resources whose ETag changed are downloaded.
+func calendarData(ctx context.Context, c *http.Client, query Query, calURL *url.URL) ([]string, error) {
+	if query.Cache == nil {
+		return reportCalendarQuery(ctx, c, calURL, query.AppleId, query.Password, query.Start, query.End)
 	}
-	return &ps[0]
-}
 
-func firstPropValue(props ical.Props, name string) string {
-	p := firstProp(props, name)
-	if p == nil {
-		return ""
-	}
-	return strings.TrimSpace(p.Value)
-}
+	if query.Sync {
+		blobs, err := syncCalendarData(ctx, c, query, calURL)
+		if err == nil {
+			return blobs, nil
+		}
 
-func parseICalDateTime(p *ical.Prop, defaultTZ *time.Location) (time.Time, bool, error) {
-	if p == nil {
-		return time.Time{}, false, fmt.Errorf("nil prop")
-	}
-	if defaultTZ == nil {
-		defaultTZ = time.Local
+		// Sync isn't supported or the token is invalid.
+		slog.Warn("sync-collection failed, falling back to calendar-query", "calendar", calURL.String(), "err", err)
+		query.Cache.SetToken(calURL.String(), "")
 	}
 
-	v := strings.TrimSpace(p.Value)
-	if v == "" {
-		return time.Time{}, false, fmt.Errorf("empty datetime")
+	resources, err := reportCalendarResources(ctx, c, calURL, query.AppleId, query.Password, query.Start, query.End, false)
+	if err != nil {
+		return nil, err
 	}
 
-	getParam := func(key string) string {
-		if p.Params == nil {
-			return ""
-		}
-		vals := p.Params[key]
-		if len(vals) == 0 {
-			return ""
+	var out []string
+	var changed []string
+	for _, r := range resources {
+		if data, ok := query.Cache.Get(resolveHref(calURL, r.Href).String(), r.ETag); ok {
+			out = append(out, data)
+			continue
 		}
-		return strings.TrimSpace(vals[0])
+		changed = append(changed, r.Href)
 	}
 
-	valueType := strings.ToUpper(getParam("VALUE"))
-	tzid := getParam("TZID")
-
-	// All-day date
-	if valueType == "DATE" || (len(v) == 8 && !strings.Contains(v, "T")) {
-		t, err := time.ParseInLocation("20060102", v, defaultTZ)
-		return t, true, err
+	if len(changed) == 0 {
+		return out, nil
 	}
 
-	// UTC
-	if strings.HasSuffix(v, "Z") {
-		if t, err := time.Parse("20060102T150405Z", v); err == nil {
-			return t, false, nil
-		}
-		if t, err := time.Parse("20060102T1504Z", v); err == nil {
-			return t, false, nil
-		}
-		return time.Time{}, false, fmt.Errorf("unsupported UTC datetime: %q", v)
+	fetched, err := multigetCalendarResources(ctx, c, calURL, query.AppleId, query.Password, changed)
+	if err != nil {
+		return nil, err
 	}
 
-	loc := defaultTZ
-	if tzid != "" {
-		if l, err := time.LoadLocation(tzid); err == nil {
-			loc = l
+	for _, r := range fetched {
+		if r.Data == "" {
+			continue
 		}
+		query.Cache.Put(resolveHref(calURL, r.Href).String(), r.ETag, r.Data)
+		out = append(out, r.Data)
 	}
-
-	if t, err := time.ParseInLocation("20060102T150405", v, loc); err == nil {
-		return t, false, nil
-	}
-	if t, err := time.ParseInLocation("20060102T1504", v, loc); err == nil {
-		return t, false, nil
-	}
-
-	return time.Time{}, false, fmt.Errorf("unsupported datetime: %q", v)
+	return out, nil
 }
@@ -0,0 +1,1034 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/brutella/smsremind/cal"
+	"github.com/brutella/smsremind/idempotency"
+)
+
+func TestEventTemplateOverridesDefault(t *testing.T) {
+	events, err := cal.ParseICS(strings.NewReader(`
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:first-visit
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Europe/Vienna:20250110T093000
+SUMMARY:Erstordination 0660 4670967
+X-SMS-TEMPLATE:Bitte kommen Sie am {{ .StartDate }} um {{ .StartTime }}\, nüchtern.
+END:VEVENT
+BEGIN:VEVENT
+UID:regular
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Europe/Vienna:20250110T110000
+SUMMARY:Kontrolle 0660 4670967
+END:VEVENT
+END:VCALENDAR`), time.UTC, cal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("%d events, want 2", len(events))
+	}
+
+	def := template.Must(template.New("default").Parse("Termin um {{ .StartTime }}"))
+	tests := map[string]string{
+		"first-visit": "Bitte kommen Sie am 2025-01-10 um 09:30, nüchtern.",
+		"regular":     "Termin um 11:00",
+	}
+
+	for _, event := range events {
+		var buf bytes.Buffer
+		if err := eventTemplate(event, def).Execute(&buf, event); err != nil {
+			t.Fatal(err)
+		}
+
+		if is, want := buf.String(), tests[event.UID]; is != want {
+			t.Fatalf("%s: %q != %q", event.UID, is, want)
+		}
+	}
+}
+
+func TestInvalidEventTemplateFallsBackToDefault(t *testing.T) {
+	def := template.Must(template.New("default").Parse("default"))
+
+	event := cal.Event{UID: "broken", Template: "{{ .StartTime "}
+	if is, want := eventTemplate(event, def), def; is != want {
+		t.Fatalf("expected default template for invalid X-SMS-TEMPLATE")
+	}
+}
+
+// calDAVServer is a minimal CalDav server with a single calendar.
+// It records every request it receives.
+type calDAVServer struct {
+	*httptest.Server
+
+	// CalendarHref is the href of the calendar collection as returned by the server.
+	CalendarHref string
+	// ICS contains the calendar-data returned by a REPORT.
+	ICS []string
+
+	mu        sync.Mutex
+	requests  []*http.Request
+	multigets []int
+	// snapshots contains the ICS at the time a sync token was issued.
+	snapshots map[string][]string
+}
+
+func newCalDAVServer(t *testing.T, ics ...string) *calDAVServer {
+	t.Helper()
+
+	s := &calDAVServer{CalendarHref: "/calendars/work/", ICS: ics}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Requests returns the requests received so far.
+func (s *calDAVServer) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request{}, s.requests...)
+}
+
+// Multigets returns the number of requested resources of every calendar-multiget.
+func (s *calDAVServer) Multigets() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int{}, s.multigets...)
+}
+
+func (s *calDAVServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	s.mu.Unlock()
+
+	var resp string
+	switch {
+	case r.Method == "PROPFIND" && strings.Contains(string(body), "current-user-principal"):
+		resp = `<d:response><d:href>/</d:href><d:propstat><d:prop>
+<d:current-user-principal><d:href>/principal/</d:href></d:current-user-principal>
+</d:prop></d:propstat></d:response>`
+	case r.Method == "PROPFIND" && strings.Contains(string(body), "calendar-home-set"):
+		resp = `<d:response><d:href>/principal/</d:href><d:propstat><d:prop>
+<c:calendar-home-set><d:href>/calendars/</d:href></c:calendar-home-set>
+</d:prop></d:propstat></d:response>`
+	case r.Method == "PROPFIND":
+		resp = fmt.Sprintf(`<d:response><d:href>/calendars/</d:href><d:propstat><d:prop>
+<d:resourcetype><d:collection/></d:resourcetype>
+</d:prop></d:propstat></d:response>
+<d:response><d:href>%s</d:href><d:propstat><d:prop>
+<d:displayname>Work</d:displayname>
+<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>
+</d:prop></d:propstat></d:response>`, s.CalendarHref)
+	case r.Method == "REPORT" && strings.Contains(string(body), "sync-collection"):
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		token := regexp.MustCompile(`<d:sync-token>(.*)</d:sync-token>`).FindStringSubmatch(string(body))[1]
+		previous, ok := s.snapshots[token]
+		if token != "" && !ok {
+			http.Error(w, `<d:error xmlns:d="DAV:"><d:valid-sync-token/></d:error>`, http.StatusForbidden)
+			return
+		}
+
+		for i, ics := range s.ICS {
+			if i < len(previous) && previous[i] == ics {
+				continue
+			}
+			resp += fmt.Sprintf(`<d:response><d:href>%s%d.ics</d:href><d:propstat><d:prop>
+<d:getetag>"%x"</d:getetag>
+</d:prop></d:propstat></d:response>`, s.CalendarHref, i, sha256.Sum256([]byte(ics)))
+		}
+
+		if s.snapshots == nil {
+			s.snapshots = map[string][]string{}
+		}
+		next := fmt.Sprintf("sync-%d", len(s.snapshots)+1)
+		s.snapshots[next] = append([]string{}, s.ICS...)
+		resp += "<d:sync-token>" + next + "</d:sync-token>"
+	case r.Method == "REPORT":
+		// A calendar-multiget only returns the requested resources,
+		// a calendar-query without calendar-data only the ETags.
+		multiget := strings.Contains(string(body), "calendar-multiget")
+		withData := strings.Contains(string(body), "calendar-data")
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if multiget {
+			s.multigets = append(s.multigets, strings.Count(string(body), "<d:href>"))
+		}
+
+		for i, ics := range s.ICS {
+			href := fmt.Sprintf("%s%d.ics", s.CalendarHref, i)
+			if multiget && !strings.Contains(string(body), "<d:href>"+href+"</d:href>") {
+				continue
+			}
+
+			var data bytes.Buffer
+			if withData {
+				data.WriteString("<c:calendar-data>")
+				xml.EscapeText(&data, []byte(strings.ReplaceAll(strings.TrimSpace(ics), "\n", "\r\n")+"\r\n"))
+				data.WriteString("</c:calendar-data>")
+			}
+			resp += fmt.Sprintf(`<d:response><d:href>%s</d:href><d:propstat><d:prop>
+<d:getetag>"%x"</d:getetag>%s
+</d:prop></d:propstat></d:response>`, href, sha256.Sum256([]byte(ics)), data.String())
+		}
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">%s</d:multistatus>`, resp)
+}
+
+const testICS = `
+BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VEVENT
+UID:appointment
+DTSTAMP:20250101T000000Z
+DTSTART;TZID=Europe/Vienna:20250110T093000
+DTEND;TZID=Europe/Vienna:20250110T100000
+SUMMARY:Kontrolle 0660 4670967
+END:VEVENT
+END:VCALENDAR`
+
+func testQuery(endpoint string) Query {
+	loc, _ := time.LoadLocation("Europe/Vienna")
+	day := time.Date(2025, 1, 10, 0, 0, 0, 0, loc)
+	return Query{
+		Endpoint: endpoint,
+		AppleId:  "user",
+		Password: "pass",
+		Start:    startOfDay(day, loc),
+		End:      endOfDay(day, loc),
+	}
+}
+
+func TestCustomHeadersOnCalDAVRequests(t *testing.T) {
+	srv := newCalDAVServer(t, testICS)
+
+	var h headerList = headerList{}
+	for _, s := range []string{"X-Api-Key: secret", "Cf-Access-Client-Id: abc"} {
+		if err := h.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := testQuery(srv.URL + "/")
+	query.Headers = http.Header(h)
+	events, err := execute(context.Background(), query, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events, want 1", len(events))
+	}
+
+	methods := map[string]int{}
+	for _, req := range srv.Requests() {
+		methods[req.Method]++
+		if is, want := req.Header.Get("X-Api-Key"), "secret"; is != want {
+			t.Fatalf("%s %s: X-Api-Key %q != %q", req.Method, req.URL.Path, is, want)
+		}
+		if is, want := req.Header.Get("Cf-Access-Client-Id"), "abc"; is != want {
+			t.Fatalf("%s %s: Cf-Access-Client-Id %q != %q", req.Method, req.URL.Path, is, want)
+		}
+	}
+
+	if methods["PROPFIND"] != 3 || methods["REPORT"] != 1 {
+		t.Fatalf("unexpected requests %v", methods)
+	}
+}
+
+func TestInvalidHeaderFlag(t *testing.T) {
+	h := headerList{}
+	for _, s := range []string{"", "no-colon", ": value"} {
+		if err := h.Set(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+}
+
+func TestAttendeeCountThresholds(t *testing.T) {
+	tests := []struct {
+		count, min, max int
+		want            bool
+	}{
+		{0, 0, 0, true},
+		{12, 0, 0, true},
+		{1, 0, 1, true},
+		{2, 0, 1, false},
+		{2, 0, 2, true},
+		{0, 1, 0, false},
+		{1, 1, 2, true},
+		{3, 1, 2, false},
+	}
+
+	for _, test := range tests {
+		if is, want := attendeesInRange(test.count, test.min, test.max), test.want; is != want {
+			t.Fatalf("%d attendees in [%d, %d]: %v != %v", test.count, test.min, test.max, is, want)
+		}
+	}
+}
+
+func TestModifiedEventTriggersCorrection(t *testing.T) {
+	store := idempotency.NewMemoryStore()
+
+	sent := cal.Event{UID: "sent", Start: time.Now().Add(24 * time.Hour)}
+	sent.Modified = time.Now().Add(-time.Hour)
+	if err := store.Mark(eventMessageKey(sent)); err != nil {
+		t.Fatal(err)
+	}
+
+	if modified, _ := modifiedSinceSent(store, sent); modified {
+		t.Fatal("unchanged event must not trigger a correction")
+	}
+
+	modified := sent
+	modified.Modified = time.Now().Add(time.Hour)
+	if modified, _ := modifiedSinceSent(store, modified); !modified {
+		t.Fatal("modified event must trigger a correction")
+	}
+
+	// After the correction was sent, the event counts as unchanged again.
+	if err := store.Mark(eventMessageKey(modified)); err != nil {
+		t.Fatal(err)
+	}
+	modified.Modified = time.Now().Add(-time.Second)
+	if modified, _ := modifiedSinceSent(store, modified); modified {
+		t.Fatal("corrected event must not trigger another correction")
+	}
+
+	unsent := cal.Event{UID: "unsent", Start: sent.Start, Modified: time.Now()}
+	if modified, _ := modifiedSinceSent(store, unsent); modified {
+		t.Fatal("unsent event must not count as correction")
+	}
+}
+
+func TestNormalizeCalendarName(t *testing.T) {
+	tests := map[string]string{
+		"Praxis":                   "Praxis",
+		"Praxis ":                  "Praxis",
+		"  Praxis  Wien\t":         "Praxis Wien",
+		"Praxis\u200b":             "Praxis",
+		"\ufeffPraxis":             "Praxis",
+		"Praxis M\u0075\u0308ller": "Praxis M\u00fcller", // NFD → NFC
+	}
+
+	for in, want := range tests {
+		if is := normalizeCalendarName(in); is != want {
+			t.Fatalf("%q: %q != %q", in, is, want)
+		}
+	}
+
+	names := parseCalendarNames("Praxis Mu\u0308ller , Physio\u200b,")
+	if is, want := strings.Join(names, "|"), "Praxis M\u00fcller|Physio"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+}
+
+func TestIncludesCalendar(t *testing.T) {
+	tests := []struct {
+		include, exclude string
+		name             string
+		want             bool
+	}{
+		{"", "", "Praxis", true},
+		{"", "Holidays,Birthdays", "Praxis", true},
+		{"", "Holidays,Birthdays", "holidays", false},
+		{"Praxis,Holidays", "", "Holidays", true},
+		{"Praxis,Holidays", "holidays", "Holidays", false},
+		{"Praxis,Holidays", "holidays", "Praxis", true},
+		{"Praxis", "Holidays", "Physio", false},
+	}
+
+	for _, test := range tests {
+		query := Query{Calendars: parseCalendarNames(test.include), ExcludeCalendars: parseCalendarNames(test.exclude)}
+		if is := query.includesCalendar(test.name); is != test.want {
+			t.Fatalf("%+v: %t != %t", test, is, test.want)
+		}
+	}
+}
+
+func TestPreflightCalendars(t *testing.T) {
+	srv := newCalDAVServer(t)
+
+	query := testQuery(srv.URL + "/")
+	query.Calendars = []string{"work"}
+	if _, err := checkCalendars(context.Background(), query); err != nil {
+		t.Fatal(err)
+	}
+
+	query.Calendars = []string{"Work", "Home"}
+	if _, err := checkCalendars(context.Background(), query); err == nil {
+		t.Fatal("expected error for missing calendar")
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	defer func(s, u string, o int) {
+		*since, *until, *offset = s, u, o
+	}(*since, *until, *offset)
+
+	loc, _ := time.LoadLocation("Europe/Vienna")
+	now := time.Date(2025, 1, 10, 9, 0, 0, 0, loc)
+	*offset = 1
+
+	tests := []struct {
+		since, until string
+		start, end   time.Time
+	}{
+		{"", "", time.Date(2025, 1, 11, 0, 0, 0, 0, loc), time.Date(2025, 1, 12, 0, 0, 0, 0, loc)},
+		{"2025-01-01", "2025-01-03", time.Date(2025, 1, 1, 0, 0, 0, 0, loc), time.Date(2025, 1, 4, 0, 0, 0, 0, loc)},
+		{"2025-01-01T12:00:00Z", "", time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), time.Date(2025, 1, 12, 0, 0, 0, 0, loc)},
+	}
+
+	for _, test := range tests {
+		*since, *until = test.since, test.until
+		start, end, err := queryRange(now, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !start.Equal(test.start) || !end.Equal(test.end) {
+			t.Fatalf("%q–%q: %s – %s, want %s – %s", test.since, test.until, start, end, test.start, test.end)
+		}
+	}
+
+	*since, *until = "2025-01-05", "2025-01-04"
+	if _, _, err := queryRange(now, loc); err == nil {
+		t.Fatal("expected error for empty range")
+	}
+
+	*since, *until = "5.1.2025", ""
+	if _, _, err := queryRange(now, loc); err == nil {
+		t.Fatal("expected error for invalid date")
+	}
+}
+
+func TestRunTimeInThePastForcesDryRun(t *testing.T) {
+	defer func(now string, dry bool) {
+		*nowFlag, *dryRun = now, dry
+	}(*nowFlag, *dryRun)
+
+	real := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	*nowFlag, *dryRun = "2025-01-12T09:00:00Z", false
+	now, err := runTime(real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !now.Equal(time.Date(2025, 1, 12, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected time %s", now)
+	}
+	if *dryRun {
+		t.Fatal("future -now must not force a dry-run")
+	}
+
+	*nowFlag = "2025-01-01T09:00:00+01:00"
+	if _, err := runTime(real); err != nil {
+		t.Fatal(err)
+	}
+	if !*dryRun {
+		t.Fatal("past -now must force a dry-run")
+	}
+
+	*nowFlag = "yesterday"
+	if _, err := runTime(real); err == nil {
+		t.Fatal("expected error for invalid -now")
+	}
+}
+
+func TestAuditRecordMasksRecipient(t *testing.T) {
+	r := newAuditRecord("key", "+436604670967", "Hello", 0, "", false)
+	if is, want := r.Recipient, "+43*******967"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+	if r.Message != "" {
+		t.Fatal("message text not expected")
+	}
+	if r.MessageHash == "" {
+		t.Fatal("message hash expected")
+	}
+
+	r = newAuditRecord("key", "+436604670967", "Hello", 0, "", true)
+	if r.Recipient != "+436604670967" || r.Message != "Hello" {
+		t.Fatalf("full record expected: %+v", r)
+	}
+}
+
+func TestCalendarURLWithoutTrailingSlash(t *testing.T) {
+	srv := newCalDAVServer(t, testICS)
+	srv.CalendarHref = "/calendars/work"
+
+	events, err := execute(context.Background(), testQuery(srv.URL+"/"), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events, want 1", len(events))
+	}
+
+	for _, req := range srv.Requests() {
+		if req.Method == "REPORT" {
+			if is, want := req.URL.Path, "/calendars/work/"; is != want {
+				t.Fatalf("REPORT %s, want %s", is, want)
+			}
+		}
+	}
+}
+
+func TestDirectCalendarURL(t *testing.T) {
+	srv := newCalDAVServer(t, testICS)
+
+	query := testQuery("")
+	query.CalendarURL = srv.URL + "/calendars/work"
+	events, err := execute(context.Background(), query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("%d events, expected 1", len(events))
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 1 || requests[0].Method != "REPORT" {
+		t.Fatalf("expected a single REPORT request, got %d requests", len(requests))
+	}
+	if is, want := requests[0].URL.Path, "/calendars/work/"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+
+	if is, want := events[0].CalendarURL, srv.URL+"/calendars/work/"; is != want {
+		t.Fatalf("%s != %s", is, want)
+	}
+}
+
+func TestPrintReminderJSON(t *testing.T) {
+	defer func(v string) { *output = v }(*output)
+	*output = "json"
+
+	srv := newCalDAVServer(t, testICS)
+	events, err := execute(context.Background(), testQuery(srv.URL), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events, expected 1", len(events))
+	}
+
+	var buf bytes.Buffer
+	if err := printReminder(&buf, events[0], "+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	var r plannedReminder
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.UID != "appointment" || r.Recipient != "+436604670967" || r.Message != "Hello" || r.Calendar != "Work" {
+		t.Fatalf("unexpected reminder %+v", r)
+	}
+	if !r.Start.Equal(events[0].Start) {
+		t.Fatalf("%s != %s", r.Start, events[0].Start)
+	}
+}
+
+func TestCheckTemplateUnknownField(t *testing.T) {
+	tmpl := template.Must(template.New("output").Parse("See you at {{ .Venue }}"))
+	if _, err := checkTemplate(tmpl, time.Now()); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+
+	tmpl = template.Must(template.New("output").Parse("See you on {{ .StartDate }} at {{ .StartTime }}"))
+	if _, err := checkTemplate(tmpl, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSentAt(t *testing.T) {
+	defer func(v string) { *templateVersion = v }(*templateVersion)
+
+	store := idempotency.NewMemoryStore()
+	event := cal.Event{UID: "appointment", Start: time.Now().Add(24 * time.Hour)}
+
+	if _, ok, _ := sentAt(store, event); ok {
+		t.Fatal("reminder must not be sent yet")
+	}
+
+	*templateVersion = "1"
+	if err := store.Mark(eventMessageKey(event)); err != nil {
+		t.Fatal(err)
+	}
+	marked, _ := store.MarkedAt(eventMessageKey(event))
+
+	// A reminder sent with another template version counts as sent
+	*templateVersion = "2"
+	sent, ok, err := sentAt(store, event)
+	if err != nil || !ok {
+		t.Fatal("reminder expected to be sent")
+	}
+	if !sent.Equal(marked) {
+		t.Fatalf("%s != %s", sent, marked)
+	}
+}
+
+func TestDeliveryTime(t *testing.T) {
+	vienna, _ := time.LoadLocation("Europe/Vienna")
+	event := cal.Event{UID: "appointment", Start: time.Date(2025, 1, 10, 14, 0, 0, 0, vienna)}
+	now := time.Date(2025, 1, 9, 21, 0, 0, 0, vienna)
+
+	at := deliveryTime(event, "+436604670967", clock{Hour: 9}, now, vienna)
+	if want := time.Date(2025, 1, 10, 9, 0, 0, 0, vienna); !at.Equal(want) {
+		t.Fatalf("%s != %s", at, want)
+	}
+
+	// The recipient lives in another timezone
+	event.Timezone = "Europe/London"
+	at = deliveryTime(event, "+436604670967", clock{Hour: 9}, now, vienna)
+	if want := time.Date(2025, 1, 10, 10, 0, 0, 0, vienna); !at.Equal(want) {
+		t.Fatalf("%s != %s", at, want)
+	}
+
+	// Delivery after the event starts
+	if at := deliveryTime(event, "+436604670967", clock{Hour: 15}, now, vienna); !at.IsZero() {
+		t.Fatalf("unexpected delivery time %s", at)
+	}
+
+	// An event in UTC for a number of several timezones is
+	// delivered in the timezone of the run (-timezone).
+	event = cal.Event{UID: "utc", Start: time.Date(2025, 1, 10, 13, 0, 0, 0, time.UTC)}
+	at = deliveryTime(event, "+18005551234", clock{Hour: 9}, now, vienna)
+	if want := time.Date(2025, 1, 10, 9, 0, 0, 0, vienna); !at.Equal(want) {
+		t.Fatalf("%s != %s", at, want)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	c, err := parseClock("09:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Hour != 9 || c.Minute != 30 {
+		t.Fatalf("unexpected clock %+v", c)
+	}
+
+	if c, err := parseClock(""); c != nil || err != nil {
+		t.Fatalf("unexpected %v, %v", c, err)
+	}
+
+	if _, err := parseClock("9h"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCalendarTemplate(t *testing.T) {
+	def := template.Must(template.New("default").Parse("default"))
+	templates, err := parseCalendarTemplates(map[string]string{
+		"Dental": "Zahnarzt um {{ .StartTime }}",
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dental := cal.Event{UID: "dental", CalendarName: "dental", Start: time.Date(2025, 1, 10, 9, 30, 0, 0, time.UTC)}
+	var buf bytes.Buffer
+	if err := calendarTemplate(dental, templates, def).Execute(&buf, dental); err != nil {
+		t.Fatal(err)
+	}
+	if is, want := buf.String(), "Zahnarzt um 09:30"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+
+	physio := cal.Event{UID: "physio", CalendarName: "Physio"}
+	if calendarTemplate(physio, templates, def) != def {
+		t.Fatal("expected default template for calendar without template")
+	}
+
+	if _, err := parseCalendarTemplates(map[string]string{"Dental": "{{ .Unknown }}"}, time.Now()); err == nil {
+		t.Fatal("expected error for invalid template")
+	}
+}
+
+func TestRegionTemplates(t *testing.T) {
+	def := template.Must(template.New("default").Parse("default"))
+	templates, err := parseRegionTemplates(map[string]string{
+		"de-AT": "Termin",
+		"de-DE": "Termin (DE)",
+		"en":    "Appointment",
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"+436604670967": "de-AT",
+		"+491711234567": "de-DE",
+		"+442071234567": "en",
+		"+33612345678":  "default",
+		"invalid":       "default",
+	}
+
+	for num, want := range tests {
+		if is := templates.template(num, def).Name(); is != want {
+			t.Fatalf("%s: %s != %s", num, is, want)
+		}
+	}
+
+	if _, err := parseRegionTemplates(map[string]string{"not a tag": "Termin"}, time.Now()); err == nil {
+		t.Fatal("expected error for invalid language tag")
+	}
+	if _, err := parseRegionTemplates(map[string]string{"de-CH": "Termin", "fr-CH": "Rendez-vous"}, time.Now()); err == nil {
+		t.Fatal("expected error for ambiguous region")
+	}
+}
+
+func TestMarkSentStoresMessage(t *testing.T) {
+	defer func(v bool) { *storeMessages = v }(*storeMessages)
+
+	store := idempotency.NewMemoryStore()
+	if err := markSent(store, "a", "+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := store.Get("a"); e.Recipient != "" || e.Message != "" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+
+	*storeMessages = true
+	if err := markSent(store, "b", "+436604670967", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := store.Get("b"); e.Recipient != "+436604670967" || e.Message != "Hello" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestOpenStoreMessagesSQLite(t *testing.T) {
+	defer func(m bool, s string) { *storeMessages, *storeType = m, s }(*storeMessages, *storeType)
+	*storeMessages, *storeType = true, "sqlite"
+
+	if _, err := openStore(); exitCode(err) != exitUsage {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestSendTestSMSDryRun(t *testing.T) {
+	defer func(v bool) { *dryRun = v }(*dryRun)
+	*dryRun = true
+
+	var buf bytes.Buffer
+	if err := sendTestSMS(&buf, nil, "0660 4670967"); err != nil {
+		t.Fatal(err)
+	}
+	if is, want := buf.String(), "test +436604670967: "+testMessage+"\n"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+
+	if err := sendTestSMS(&buf, nil, "+43 1"); err == nil {
+		t.Fatal("expected error for invalid number")
+	}
+}
+
+func TestParseCalendarSenders(t *testing.T) {
+	senders, err := parseCalendarSenders(map[string]string{"Dental": "Zahnarzt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is, want := senders[calendarKey("dental")], "Zahnarzt"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+
+	if _, err := parseCalendarSenders(map[string]string{"Dental": "DentalClinic"}); err == nil {
+		t.Fatal("expected error for sender with more than 11 characters")
+	}
+}
+
+func TestETagCache(t *testing.T) {
+	srv := newCalDAVServer(t, testICS, strings.Replace(testICS, "UID:appointment", "UID:other", 1))
+
+	path := filepath.Join(t.TempDir(), "calendars.json")
+	fetch := func() {
+		t.Helper()
+
+		cache, err := openCalendarCache(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		query := testQuery(srv.URL)
+		query.Cache = cache
+		events, err := execute(context.Background(), query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("%d events, expected 2", len(events))
+		}
+
+		if err := cache.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetch()
+	if is, want := srv.Multigets(), []int{2}; fmt.Sprint(is) != fmt.Sprint(want) {
+		t.Fatalf("multiget of %v resources, expected %v", is, want)
+	}
+
+	// Nothing changed
+	fetch()
+	if is, want := srv.Multigets(), []int{2}; fmt.Sprint(is) != fmt.Sprint(want) {
+		t.Fatalf("multiget of %v resources, expected %v", is, want)
+	}
+
+	srv.mu.Lock()
+	srv.ICS[1] = strings.Replace(srv.ICS[1], "SUMMARY:", "SUMMARY:Changed ", 1)
+	srv.mu.Unlock()
+
+	fetch()
+	if is, want := srv.Multigets(), []int{2, 1}; fmt.Sprint(is) != fmt.Sprint(want) {
+		t.Fatalf("multiget of %v resources, expected %v", is, want)
+	}
+}
+
+func TestMultigetCalendarResources(t *testing.T) {
+	// Recorded response of a multiget of an existing and a deleted resource.
+	const multistatus = `<?xml version="1.0" encoding="UTF-8"?>
+<multistatus xmlns="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <response>
+    <href>/calendars/home/a%20b.ics</href>
+    <propstat>
+      <prop>
+        <getetag>"1"</getetag>
+        <C:calendar-data>BEGIN:VCALENDAR
+END:VCALENDAR
+</C:calendar-data>
+      </prop>
+      <status>HTTP/1.1 200 OK</status>
+    </propstat>
+  </response>
+  <response>
+    <href>/calendars/home/deleted.ics</href>
+    <status>HTTP/1.1 404 Not Found</status>
+  </response>
+</multistatus>`
+
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, multistatus)
+	}))
+	defer srv.Close()
+
+	calURL, _ := url.Parse(srv.URL + "/calendars/home/")
+	hrefs := []string{"/calendars/home/a%20b.ics", "/calendars/home/deleted.ics?x=1&y=2"}
+	resources, err := multigetCalendarResources(context.Background(), srv.Client(), calURL, "user", "pass", hrefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(body, "<d:href>/calendars/home/deleted.ics?x=1&amp;y=2</d:href>") {
+		t.Fatalf("href not escaped in %s", body)
+	}
+
+	if len(resources) != 2 {
+		t.Fatalf("%d resources, expected 2", len(resources))
+	}
+	if r := resources[0]; r.ETag != `"1"` || r.Data != "BEGIN:VCALENDAR\nEND:VCALENDAR" {
+		t.Fatalf("unexpected resource %+v", r)
+	}
+	if r := resources[1]; r.Href != "/calendars/home/deleted.ics" || r.Data != "" {
+		t.Fatalf("unexpected resource %+v", r)
+	}
+}
+
+func TestSyncCollection(t *testing.T) {
+	srv := newCalDAVServer(t, testICS, strings.Replace(testICS, "UID:appointment", "UID:other", 1))
+
+	// The range only contains the events of 2025-01-10
+	srv.ICS = append(srv.ICS, strings.NewReplacer("UID:appointment", "UID:later", "20250110", "20250120").Replace(testICS))
+
+	cache, err := openCalendarCache(filepath.Join(t.TempDir(), "calendars.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := testQuery(srv.URL)
+	query.Cache = cache
+	query.Sync = true
+	fetch := func() {
+		t.Helper()
+
+		events, err := execute(context.Background(), query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("%d events, expected 2", len(events))
+		}
+	}
+
+	fetch()
+	if is, want := srv.Multigets(), []int{3}; fmt.Sprint(is) != fmt.Sprint(want) {
+		t.Fatalf("multiget of %v resources, expected %v", is, want)
+	}
+
+	// Nothing changed
+	fetch()
+	if is, want := srv.Multigets(), []int{3}; fmt.Sprint(is) != fmt.Sprint(want) {
+		t.Fatalf("multiget of %v resources, expected %v", is, want)
+	}
+
+	srv.mu.Lock()
+	srv.ICS[1] = strings.Replace(srv.ICS[1], "SUMMARY:", "SUMMARY:Changed ", 1)
+	srv.mu.Unlock()
+
+	fetch()
+	if is, want := srv.Multigets(), []int{3, 1}; fmt.Sprint(is) != fmt.Sprint(want) {
+		t.Fatalf("multiget of %v resources, expected %v", is, want)
+	}
+
+	// An invalid token falls back to the calendar-query
+	cache.SetToken(srv.URL+srv.CalendarHref, "invalid")
+	fetch()
+	if is, want := srv.Multigets(), []int{3, 1}; fmt.Sprint(is) != fmt.Sprint(want) {
+		t.Fatalf("multiget of %v resources, expected %v", is, want)
+	}
+	if token := cache.Token(srv.URL + srv.CalendarHref); token != "" {
+		t.Fatalf("unexpected token %q after fallback", token)
+	}
+}
+
+func TestReadICSFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calendar.ics")
+	if err := os.WriteFile(path, []byte(testICS), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	query := testQuery("")
+	events, err := readICSFile(path, time.UTC, query.Start, query.End)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].UID != "appointment" {
+		t.Fatalf("unexpected events %v", events)
+	}
+
+	// The event is not in range on the next day
+	events, err = readICSFile(path, time.UTC, query.End, query.End.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("%d events, expected 0", len(events))
+	}
+}
+
+func TestCalDAVTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	c := newCalDAVClient(Query{Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, _, _, err := doDAV(context.Background(), c, "PROPFIND", u, "user", "pass", "0", nil); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("request took %s", d)
+	}
+}
+
+func TestDecodeCalendarResources(t *testing.T) {
+	const n = 5000
+
+	// The multistatus is written while it is decoded.
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		fmt.Fprint(pw, `<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(pw, `<d:response><d:href>/cal/%d.ics</d:href><d:propstat><d:prop><d:getetag>"%d"</d:getetag><c:calendar-data>BEGIN:VCALENDAR
+UID:%d
+END:VCALENDAR</c:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, i, i, i)
+		}
+		fmt.Fprint(pw, `<d:response><d:href>/cal/</d:href><d:status>HTTP/1.1 507 Insufficient Storage</d:status></d:response></d:multistatus>`)
+		pw.Close()
+	}()
+
+	var count int
+	err := decodeCalendarResources(pr, func(r calendarResource) {
+		if r.Href != fmt.Sprintf("/cal/%d.ics", count) || r.ETag != fmt.Sprintf(`"%d"`, count) || !strings.Contains(r.Data, fmt.Sprintf("UID:%d\n", count)) {
+			t.Fatalf("unexpected resource %+v", r)
+		}
+		count++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Fatalf("%d resources, expected %d", count, n)
+	}
+
+	if err := decodeCalendarResources(strings.NewReader(""), func(calendarResource) {}); err == nil {
+		t.Fatal("error expected for an empty response")
+	}
+}
+
+func TestDoDAVUserAgent(t *testing.T) {
+	defer func(v string) { *userAgent = v }(*userAgent)
+	*userAgent = "smsremind/1.0"
+
+	var ua string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.UserAgent()
+		w.WriteHeader(http.StatusMultiStatus)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	if _, _, _, err := doDAV(context.Background(), srv.Client(), "PROPFIND", u, "user", "pass", "0", nil); err != nil {
+		t.Fatal(err)
+	}
+	if ua != "smsremind/1.0" {
+		t.Fatalf("unexpected User-Agent %q", ua)
+	}
+}
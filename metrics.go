@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var metricsFile = flag.String("metrics-file", "", "Write the metrics of every run to this file for the textfile collector of the Prometheus node exporter (e.g. smsremind.prom).")
+
+// runMetrics counts the outcome of a run.
+type runMetrics struct {
+	Sent    int
+	Skipped int
+	Errors  int
+}
+
+// metric is a sample in the Prometheus text format.
+type metric struct {
+	Name  string
+	Help  string
+	Type  string
+	Value float64
+}
+
+// writeMetrics adds the metrics of a run to the counters in the file at path
+// and sets the time of the last run to now.
+func writeMetrics(path string, m runMetrics, now time.Time) error {
+	prev := readMetrics(path)
+	metrics := []metric{
+		{"smsremind_sent_total", "Number of sent reminders.", "counter", prev["smsremind_sent_total"] + float64(m.Sent)},
+		{"smsremind_skipped_total", "Number of events in range for which no reminder was sent.", "counter", prev["smsremind_skipped_total"] + float64(m.Skipped)},
+		{"smsremind_errors_total", "Number of failed reminders and runs.", "counter", prev["smsremind_errors_total"] + float64(m.Errors)},
+		{"smsremind_last_run_timestamp_seconds", "Time of the last run.", "gauge", float64(now.Unix())},
+	}
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", m.Name, m.Help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", m.Name, m.Type)
+		fmt.Fprintf(&buf, "%s %s\n", m.Name, strconv.FormatFloat(m.Value, 'f', -1, 64))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// The collector must never read a partially written file.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readMetrics returns the values of the samples in the file at path.
+// The counters of a missing or invalid file start at 0.
+func readMetrics(path string) map[string]float64 {
+	values := map[string]float64{}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return values
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values
+}
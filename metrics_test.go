@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "smsremind.prom")
+	now := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	if err := writeMetrics(path, runMetrics{Sent: 2, Skipped: 1}, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMetrics(path, runMetrics{Sent: 1, Errors: 1}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"# TYPE smsremind_sent_total counter",
+		"smsremind_sent_total 3",
+		"smsremind_skipped_total 1",
+		"smsremind_errors_total 1",
+		"smsremind_last_run_timestamp_seconds 1736503200",
+	} {
+		if !strings.Contains(string(b), line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, b)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/brutella/smsremind/aspsms"
+	"github.com/brutella/smsremind/cal"
+	"github.com/brutella/smsremind/idempotency"
+)
+
+// eventSource returns the events in the range of a run,
+// e.g. from a CalDav server or an ICS file.
+type eventSource func(ctx context.Context) ([]cal.Event, error)
+
+// planConfig contains what plan needs to decide on the reminders of a run.
+type planConfig struct {
+	Events eventSource
+	Now    time.Time
+	// Store is only read.
+	Store idempotency.StateStore
+	// Summary skips the events of which the summary doesn't match, if set.
+	Summary *regexp.Regexp
+	// RemindCancelled includes cancelled events, see -remind-cancelled.
+	RemindCancelled bool
+	// MinAttendees and MaxAttendees limit the number of attendees,
+	// see -min-attendees and -max-attendees.
+	MinAttendees, MaxAttendees int
+	// SkipKeyword is the marker of suppressed events, see -skip-keyword.
+	SkipKeyword string
+	// RequireCategory skips events without this category, if set.
+	RequireCategory string
+	// DuplicateThreshold is the threshold of -duplicate-threshold.
+	DuplicateThreshold int
+	// ResendOnModify resends reminders of modified events, see -resend-on-modify.
+	ResendOnModify bool
+	// SeedOnly plans reminders without rendering a message, see -seed-only.
+	SeedOnly bool
+	// DisplayLocation is set as cal.Event.DisplayLocation of every event.
+	DisplayLocation *time.Location
+
+	Template          *template.Template
+	CalendarTemplates map[string]*template.Template
+	RegionTemplates   regionTemplates
+}
+
+// plan returns a reminder for every event in range. Reminders which are
+// sent have a rendered message, the others a Skip reason.
+// Nothing is sent or marked; with SeedOnly no message is rendered.
+func plan(ctx context.Context, cfg planConfig) ([]reminder, error) {
+	events, err := cfg.Events(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out, due []reminder
+	for _, event := range events {
+		event.DisplayLocation = cfg.DisplayLocation
+		r := reminder{Event: event}
+		switch {
+		case event.Status == "CANCELLED" && !cfg.RemindCancelled:
+			r.Skip = "skipped-cancelled"
+		case !attendeesInRange(event.AttendeeCount(), cfg.MinAttendees, cfg.MaxAttendees):
+			r.Skip, r.Detail = "skipped-attendees", fmt.Sprintf("%d attendees", event.AttendeeCount())
+		case event.Suppressed(cfg.SkipKeyword):
+			r.Skip = "skipped-suppressed"
+		case cfg.RequireCategory != "" && !event.HasCategory(cfg.RequireCategory):
+			r.Skip, r.Detail = "skipped-category", strings.Join(event.Categories, ",")
+		case cfg.Summary != nil && !cfg.Summary.MatchString(event.Summary):
+			r.Skip = "skipped-summary"
+		default:
+			r.Recipient = cal.EventPhoneNumber(event)
+			if r.Recipient == "" {
+				r.Skip, r.Detail = "skipped-no-number", attendeeStatus(event)
+			}
+		}
+
+		if r.Skip == "" {
+			if event.Status == "TENTATIVE" {
+				slog.Info("event is tentative", "uid", event.UID)
+			}
+			r.Event.LeadDays = event.DaysUntil(cfg.Now)
+			due = append(due, r)
+		}
+		out = append(out, r)
+	}
+
+	// Same number on unrelated events is most likely a copy-paste mistake.
+	// This is only reported, the reminders are sent nevertheless.
+	for num, uids := range duplicateRecipients(due, cfg.DuplicateThreshold) {
+		slog.Warn("recipient of distinct events", "recipient", num, "events", len(uids), "uids", strings.Join(uids, ", "))
+	}
+
+	for i := range out {
+		r := &out[i]
+		if r.Skip != "" {
+			continue
+		}
+
+		// A store which can't be read must not count reminders as unsent.
+		sent, ok, err := sentAt(cfg.Store, r.Event)
+		if err != nil {
+			return nil, fmt.Errorf("state of %s: %w", r.Event.UID, err)
+		}
+		if ok {
+			modified := false
+			if cfg.ResendOnModify {
+				if modified, err = modifiedSinceSent(cfg.Store, r.Event); err != nil {
+					return nil, fmt.Errorf("state of %s: %w", r.Event.UID, err)
+				}
+			}
+			if !modified {
+				// Skip messages which where already sent.
+				r.Skip, r.Detail = "skipped-already-sent", sent.Format(time.RFC3339)
+				continue
+			}
+			slog.Info("event was modified after the reminder was sent, sending correction", "uid", r.Event.UID)
+		}
+
+		if cfg.SeedOnly {
+			continue
+		}
+
+		// Generate a new message
+		tmpl := eventTemplate(r.Event, calendarTemplate(r.Event, cfg.CalendarTemplates, cfg.RegionTemplates.template(r.Recipient, cfg.Template)))
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, r.Event); err != nil {
+			return nil, err
+		}
+		r.Message = buf.String()
+
+		// Messages with more than one part are billed per part.
+		if enc, parts, chars := aspsms.MessageInfo(r.Message); parts > 1 {
+			slog.Warn("message is split into several SMS", "uid", r.Event.UID, "parts", parts, "chars", chars, "encoding", enc)
+		}
+	}
+	return out, nil
+}
+
+// applyConfig contains what apply needs to send the planned reminders.
+type applyConfig struct {
+	Now time.Time
+	// Location is the timezone of the run (-timezone), which is also used
+	// for -deliver-at if the timezone of the recipient is unknown.
+	Location *time.Location
+	Store    idempotency.StateStore
+	Audit    *idempotency.AuditLog
+	Accounts aspsms.Failover
+	// Senders contains the SMS senders by calendar key.
+	Senders   map[string]string
+	DeliverAt *clock
+	Quiet     *quietHours
+	Metrics   *runMetrics
+
+	// DryRun and Sandbox don't send anything, see -dry-run and -sms-sandbox.
+	DryRun, Sandbox bool
+	// Concurrency is the number of reminders sent at the same time.
+	Concurrency int
+	// MaxSMS stops sending after this many reminders (0 = no limit).
+	MaxSMS int
+	// AuditFull writes the full number and message to the audit log.
+	AuditFull bool
+}
+
+// errStopped is returned by apply if it stopped early because of the
+// -max-sms fuse or a reminder which couldn't be marked.
+var errStopped = errors.New("not sending the remaining reminders")
+
+// apply sends the planned reminders and marks them as sent.
+// With DryRun or Sandbox nothing is sent.
+// Up to Concurrency reminders are sent at the same time; the decisions
+// are reported in the order of planned nevertheless.
+// Failed reminders are not marked, so a later run tries again,
+// and are returned as a joined error.
+func apply(ctx context.Context, planned []reminder, cfg applyConfig) error {
+	a := &applier{cfg: cfg}
+	results := make([]applyResult, len(planned))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(cfg.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = a.apply(ctx, planned[i])
+			}
+		}()
+	}
+
+	for i := range planned {
+		if ctx.Err() != nil || a.isStopped() {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return a.report(ctx, planned, results)
+}
+
+// applyResult is the outcome of a planned reminder.
+type applyResult struct {
+	// Decision is reported with -explain, e.g. "sent" or "failed".
+	// It is empty if the reminder was not applied.
+	Decision string
+	Detail   string
+	// Err is the error of a reminder which was not sent or marked.
+	Err error
+}
+
+// applier applies planned reminders, possibly from several goroutines.
+type applier struct {
+	cfg applyConfig
+
+	mu sync.Mutex
+	// sends counts the sent reminders and the ones being sent.
+	sends int
+	// stopped is set by the -max-sms fuse and if a reminder can't be marked.
+	stopped bool
+}
+
+func (a *applier) isStopped() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stopped
+}
+
+// reserve counts a reminder which is about to be sent. Once -max-sms
+// reminders are counted, it returns false and stops the remaining reminders.
+// Safety fuse: events which are not sent are not marked either,
+// so they are sent by a later run once the cause is fixed.
+func (a *applier) reserve() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cfg.MaxSMS > 0 && a.sends >= a.cfg.MaxSMS {
+		a.stopped = true
+		return false
+	}
+	a.sends++
+	return true
+}
+
+// release uncounts a reserved reminder which was not sent.
+func (a *applier) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sends--
+}
+
+// apply sends a reminder and marks it as sent.
+func (a *applier) apply(ctx context.Context, r reminder) applyResult {
+	// Reminders which were sent are marked already.
+	if ctx.Err() != nil || a.isStopped() {
+		return applyResult{}
+	}
+
+	cfg := a.cfg
+	event, num, msg := r.Event, r.Recipient, r.Message
+	key := eventMessageKey(event)
+
+	var at time.Time
+	if cfg.DeliverAt != nil {
+		at = deliveryTime(event, num, *cfg.DeliverAt, cfg.Now, cfg.Location)
+		if at.IsZero() {
+			slog.Info("delivery time is in the past or after the event, sending immediately", "uid", event.UID)
+		}
+	}
+
+	if cfg.Quiet != nil {
+		delivery := cfg.Now
+		if !at.IsZero() {
+			delivery = at
+		}
+		delivery = delivery.In(cfg.Location)
+
+		if next := cfg.Quiet.next(delivery); !next.Equal(delivery) {
+			if cfg.Quiet.Skip || !next.Before(event.Start) {
+				// Not marked as sent, a later run tries again.
+				slog.Info("reminder falls into quiet hours, not sending", "uid", event.UID, "at", delivery.Format(time.RFC3339))
+				return applyResult{Decision: "skipped-quiet-hours", Detail: delivery.Format(time.RFC3339)}
+			}
+			at = next
+			slog.Info("reminder falls into quiet hours, deferring delivery", "uid", event.UID, "at", at.Format(time.RFC3339))
+		}
+	}
+
+	if cfg.DryRun {
+		a.mu.Lock()
+		a.sends++
+		n := a.sends
+		a.mu.Unlock()
+
+		if cfg.MaxSMS > 0 && n == cfg.MaxSMS+1 {
+			slog.Warn("more reminders planned than -max-sms, a real run stops early", "max-sms", cfg.MaxSMS)
+		}
+		return applyResult{Decision: "would-send", Detail: num}
+	}
+
+	if cfg.Sandbox {
+		_, err := cfg.Accounts.Do(func(c *aspsms.Client) error {
+			if from, ok := cfg.Senders[calendarKey(event.CalendarName)]; ok {
+				var err error
+				if c, err = c.WithOriginator(from); err != nil {
+					return err
+				}
+			}
+			return c.Validate(num, msg)
+		})
+		if err != nil {
+			return applyResult{Decision: "sandbox", Detail: fmt.Sprintf("rejected: %v", err)}
+		}
+		return applyResult{Decision: "sandbox", Detail: "accepted"}
+	}
+
+	if !a.reserve() {
+		return applyResult{Decision: "max-sms"}
+	}
+
+	var ref string
+	account, err := cfg.Accounts.Do(func(c *aspsms.Client) error {
+		var err error
+		if from, ok := cfg.Senders[calendarKey(event.CalendarName)]; ok {
+			if c, err = c.WithOriginator(from); err != nil {
+				return err
+			}
+		}
+
+		if at.IsZero() {
+			ref, err = c.SendTextSMSContext(ctx, num, msg)
+		} else {
+			ref, err = c.SendDeferredTextSMSContext(ctx, num, msg, at)
+		}
+		return err
+	})
+	if aspsms.IsRateLimited(err) {
+		// Not marked as sent, the next run tries again.
+		a.release()
+		slog.Warn("reminder not sent", "uid", event.UID, "err", err)
+		return applyResult{Decision: "rate-limited", Err: err}
+	}
+	if err != nil {
+		// Not marked as sent either, the other reminders are sent nevertheless.
+		a.release()
+		slog.Error("reminder not sent", "uid", event.UID, "recipient", num, "err", err)
+		return applyResult{Decision: "failed", Detail: err.Error(), Err: fmt.Errorf("%s to %s: %w", event.UID, num, err)}
+	}
+	slog.Info("reminder sent", "uid", event.UID, "account", account+1, "reference", ref)
+	if !at.IsZero() {
+		slog.Info("reminder is delivered later", "uid", event.UID, "at", at.Format(time.RFC3339))
+	}
+
+	if cfg.Audit != nil {
+		record := newAuditRecord(key, num, msg, account, ref, cfg.AuditFull)
+		record.Calendar = event.CalendarName
+		if err := cfg.Audit.Append(record); err != nil {
+			slog.Error("audit log", "err", err)
+		}
+	}
+
+	if err := markSent(cfg.Store, key, num, msg); err != nil {
+		a.mu.Lock()
+		a.stopped = true
+		a.mu.Unlock()
+		return applyResult{Decision: "not-marked", Err: fmt.Errorf("%s was sent but not recorded and may be sent again: %w", event.UID, err)}
+	}
+	return applyResult{Decision: "sent", Detail: num}
+}
+
+// report updates the metrics and explains the decisions in the order
+// of planned. It returns the failures as a joined error. The exit code
+// of the error is exitASPSMS if nothing was sent because ASPSMS rejected
+// every reminder, exitFailure if a sent reminder couldn't be marked
+// and exitPartial otherwise.
+func (a *applier) report(ctx context.Context, planned []reminder, results []applyResult) error {
+	var failures []error
+	var applied, sent, rateLimited, failed, rejected int
+	var fused, notMarked bool
+	for i, res := range results {
+		r := planned[i]
+		switch res.Decision {
+		case "":
+			continue
+		case "sent":
+			sent++
+			a.cfg.Metrics.Sent++
+		case "skipped-quiet-hours":
+			a.cfg.Metrics.Skipped++
+		case "sandbox":
+			fmt.Fprintf(os.Stdout, "sandbox %s %s: %s\n", r.Event.Summary, r.Recipient, res.Detail)
+		case "rate-limited":
+			rateLimited++
+			a.cfg.Metrics.Errors++
+		case "failed":
+			failures = append(failures, res.Err)
+			a.cfg.Metrics.Errors++
+		case "not-marked":
+			failures = append(failures, res.Err)
+			notMarked = true
+		case "max-sms":
+			fused = true
+		}
+		applied++
+
+		if res.Decision == "rate-limited" || res.Decision == "failed" {
+			failed++
+			if isASPSMSError(res.Err) {
+				rejected++
+			}
+		}
+
+		switch res.Decision {
+		case "sent", "would-send", "skipped-quiet-hours", "failed":
+			explainDecision(r.Event, res.Decision, res.Detail)
+		}
+	}
+
+	if fused {
+		failures = append(failures, fmt.Errorf("-max-sms %d reached, %w", a.cfg.MaxSMS, errStopped))
+	} else if notMarked {
+		failures = append(failures, errStopped)
+	} else if ctx.Err() != nil && applied < len(planned) {
+		slog.Warn("interrupted, not sending the remaining reminders", "sent", sent, "remaining", len(planned)-applied)
+		failures = append(failures, fmt.Errorf("interrupted after %d of %d reminders", applied, len(planned)))
+	}
+
+	if rateLimited > 0 {
+		failures = append(failures, fmt.Errorf("%d reminders not sent because of rate limiting", rateLimited))
+	}
+
+	code := exitPartial
+	switch {
+	case notMarked:
+		code = exitFailure
+	case sent == 0 && failed > 0 && failed == rejected:
+		code = exitASPSMS
+	}
+	return withExitCode(code, errors.Join(failures...))
+}
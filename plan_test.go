@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/brutella/smsremind/aspsms"
+	"github.com/brutella/smsremind/cal"
+	"github.com/brutella/smsremind/idempotency"
+)
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2025, 1, 9, 9, 0, 0, 0, time.UTC)
+	start := now.AddDate(0, 0, 1).Add(30 * time.Minute)
+
+	events := []cal.Event{
+		{UID: "due", Summary: "0660 4670967", Start: start, Categories: []string{"Work", "APPOINTMENT"}},
+		{UID: "sent", Summary: "0660 1234567", Start: start, Categories: []string{"APPOINTMENT"}},
+		{UID: "cancelled", Summary: "0660 4670967", Start: start, Status: "CANCELLED"},
+		{UID: "suppressed", Summary: "0660 4670967 #nosms", Start: start},
+		{UID: "no-number", Summary: "Lunch", Start: start, Categories: []string{"APPOINTMENT"}},
+		{UID: "uncategorized", Summary: "0660 4670967", Start: start, Categories: []string{"Private"}},
+		{UID: "other-summary", Summary: "Call 0660 4670967", Start: start, Categories: []string{"APPOINTMENT"}},
+	}
+	source := func(ctx context.Context) ([]cal.Event, error) {
+		return events, nil
+	}
+
+	store := idempotency.NewMemoryStore()
+	if err := store.Mark(eventMessageKey(events[1])); err != nil {
+		t.Fatal(err)
+	}
+
+	reminders, err := plan(context.Background(), planConfig{
+		Events:          source,
+		Now:             now,
+		Store:           store,
+		Summary:         regexp.MustCompile(`^(\d|Lunch)`),
+		SkipKeyword:     "#nosms",
+		RequireCategory: "appointment",
+		Template:        template.Must(template.New("output").Parse("{{ .StartTime }} in {{ .LeadDays }} day")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"due":           "",
+		"sent":          "skipped-already-sent",
+		"cancelled":     "skipped-cancelled",
+		"suppressed":    "skipped-suppressed",
+		"no-number":     "skipped-no-number",
+		"uncategorized": "skipped-category",
+		"other-summary": "skipped-summary",
+	}
+	if len(reminders) != len(want) {
+		t.Fatalf("%d reminders, expected %d", len(reminders), len(want))
+	}
+	for _, r := range reminders {
+		if is := r.Skip; is != want[r.Event.UID] {
+			t.Fatalf("%s: %q != %q", r.Event.UID, is, want[r.Event.UID])
+		}
+	}
+
+	due := reminders[0]
+	if due.Recipient != "+436604670967" || due.Message != "09:30 in 1 day" {
+		t.Fatalf("unexpected reminder %+v", due)
+	}
+
+	// Planning has no side effects.
+	if keys, _ := store.Keys(); len(keys) != 1 {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestApplyConcurrent(t *testing.T) {
+	quiet, err := parseQuietHours("21:00", "07:30", "defer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reminders of events before the end of the quiet hours are skipped,
+	// the others are deferred.
+	now := time.Date(2025, 1, 9, 22, 0, 0, 0, time.UTC)
+	var planned []reminder
+	for i := range 20 {
+		start := now.Add(time.Hour)
+		if i%2 == 0 {
+			start = now.AddDate(0, 0, 1)
+		}
+		planned = append(planned, reminder{Event: cal.Event{UID: fmt.Sprint(i), Start: start}, Recipient: "+436604670967"})
+	}
+
+	var metrics runMetrics
+	err = apply(context.Background(), planned, applyConfig{
+		Now:         now,
+		Location:    time.UTC,
+		Store:       idempotency.NewMemoryStore(),
+		Quiet:       quiet,
+		Metrics:     &metrics,
+		DryRun:      true,
+		Concurrency: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Skipped != 10 {
+		t.Fatalf("%d skipped, want 10", metrics.Skipped)
+	}
+}
+
+func TestApplyConcurrentSends(t *testing.T) {
+	var mu sync.Mutex
+	var sends, inFlight, maxInFlight int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sends++
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		// Keep the requests open, so that they overlap.
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		fmt.Fprint(w, `{"ErrorCode":1,"ErrorDescription":"OK"}`)
+	}))
+	defer srv.Close()
+
+	c := aspsms.NewClient("key", "password", "Test", time.Second)
+	c.SetBaseURL(srv.URL)
+
+	now := time.Date(2025, 1, 9, 9, 0, 0, 0, time.UTC)
+	var planned []reminder
+	for i := range 10 {
+		event := cal.Event{UID: fmt.Sprint(i), Start: now.AddDate(0, 0, 1)}
+		planned = append(planned, reminder{Event: event, Recipient: "+436604670967", Message: "Hello"})
+	}
+
+	store := idempotency.NewMemoryStore()
+	var metrics runMetrics
+	err := apply(context.Background(), planned, applyConfig{
+		Now:         now,
+		Location:    time.UTC,
+		Store:       store,
+		Accounts:    aspsms.Failover{c},
+		Metrics:     &metrics,
+		Concurrency: 4,
+		MaxSMS:      3,
+	})
+	if !errors.Is(err, errStopped) || !strings.Contains(err.Error(), "-max-sms 3 reached") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if sends != 3 {
+		t.Fatalf("%d sends, want 3", sends)
+	}
+	if keys, _ := store.Keys(); len(keys) != 3 {
+		t.Fatalf("%d marked, want 3", len(keys))
+	}
+	if metrics.Sent != 3 {
+		t.Fatalf("%d sent, want 3", metrics.Sent)
+	}
+	if maxInFlight < 2 {
+		t.Fatalf("reminders were not sent concurrently")
+	}
+}
+
+func TestApplyInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	planned := []reminder{{Event: cal.Event{UID: "a"}}, {Event: cal.Event{UID: "b"}}}
+	err := apply(ctx, planned, applyConfig{Store: idempotency.NewMemoryStore(), Metrics: &runMetrics{}, DryRun: true})
+	if err == nil || !strings.Contains(err.Error(), "interrupted after 0 of 2 reminders") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestPlanStoreError(t *testing.T) {
+	store, err := idempotency.OpenSQLite(filepath.Join(t.TempDir(), "sent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Queries of a closed database fail.
+	store.Close()
+
+	source := func(ctx context.Context) ([]cal.Event, error) {
+		return []cal.Event{{UID: "due", Summary: "0660 4670967", Start: time.Now().Add(24 * time.Hour)}}, nil
+	}
+	_, err = plan(context.Background(), planConfig{
+		Events:   source,
+		Now:      time.Now(),
+		Store:    store,
+		Template: template.Must(template.New("output").Parse("{{ .StartTime }}")),
+	})
+	if err == nil {
+		t.Fatal("an unreadable store must abort the run")
+	}
+}
+
+func TestReportExitCode(t *testing.T) {
+	planned := []reminder{{Event: cal.Event{UID: "a"}}, {Event: cal.Event{UID: "b"}}}
+	rejected := applyResult{Decision: "failed", Err: &aspsms.Error{Code: aspsms.CodeInvalidRecipient}}
+
+	tests := []struct {
+		results []applyResult
+		want    int
+	}{
+		// ASPSMS rejected every reminder.
+		{[]applyResult{rejected, rejected}, exitASPSMS},
+		{[]applyResult{{Decision: "sent"}, rejected}, exitPartial},
+		{[]applyResult{{Decision: "failed", Err: fmt.Errorf("template")}, rejected}, exitPartial},
+		{[]applyResult{{Decision: "sent"}, {Decision: "not-marked", Err: fmt.Errorf("disk full")}}, exitFailure},
+	}
+
+	for _, test := range tests {
+		a := &applier{cfg: applyConfig{Metrics: &runMetrics{}}}
+		if is := exitCode(a.report(context.Background(), planned, test.results)); is != test.want {
+			t.Fatalf("%+v: %d != %d", test.results, is, test.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/brutella/smsremind/aspsms"
+	"github.com/brutella/smsremind/cal"
+)
+
+// preflightCheck is a single check of the setup.
+type preflightCheck struct {
+	Name string
+	// Code is the exit code if the check fails.
+	Code  int
+	Check func() (string, error)
+}
+
+// runPreflight checks the whole setup without sending anything.
+// The template is rendered for an event on day, and the CalDav
+// accounts are checked with queries.
+// It reports the result of every check and returns an error if any check
+// failed, with the exit code of the first failed check.
+func runPreflight(ctx context.Context, day time.Time, queries []Query, tmpl *template.Template, accounts aspsms.Failover) error {
+	checks := []preflightCheck{
+		{"template", exitUsage, func() (string, error) {
+			return checkTemplate(tmpl, day)
+		}},
+	}
+
+	for i, c := range accounts {
+		checks = append(checks, preflightCheck{fmt.Sprintf("aspsms account %d", i+1), exitASPSMS, func() (string, error) {
+			credits, err := c.Credits()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%.2f credits", credits), nil
+		}})
+	}
+
+	for i, query := range queries {
+		name := "caldav"
+		if len(queries) > 1 {
+			name = fmt.Sprintf("caldav account %d", i+1)
+		}
+		checks = append(checks, preflightCheck{name, exitCalDAV, func() (string, error) {
+			return checkCalendars(ctx, query)
+		}})
+	}
+
+	checks = append(checks, preflightCheck{"state dir", exitFailure, func() (string, error) {
+		return *stateDir, checkWritable(*stateDir)
+	}})
+
+	var failed []string
+	var code int
+	for _, c := range checks {
+		result, err := c.Check()
+		if err != nil {
+			if len(failed) == 0 {
+				code = c.Code
+			}
+			failed = append(failed, c.Name)
+			fmt.Fprintf(os.Stdout, "FAIL %s: %v\n", c.Name, err)
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "ok   %s: %s\n", c.Name, result)
+	}
+
+	if len(failed) > 0 {
+		return withExitCode(code, fmt.Errorf("preflight failed: %s", strings.Join(failed, ", ")))
+	}
+	return nil
+}
+
+// checkTemplate renders the template for a sample event on day.
+func checkTemplate(tmpl *template.Template, day time.Time) (string, error) {
+	start := day.Add(9 * time.Hour)
+	event := cal.Event{
+		UID:         "preflight",
+		Start:       start,
+		End:         start.Add(30 * time.Minute),
+		Summary:     "Sample 0660 4670967",
+		Description: "Sample description",
+		Location:    "Sample location",
+		Organizer:   "Sample organizer",
+		LeadDays:    *offset,
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%q", buf.String()), nil
+}
+
+// checkCalendars runs the CalDav discovery and checks that the
+// calendars of the query exist. A direct calendar URL is queried instead.
+func checkCalendars(ctx context.Context, query Query) (string, error) {
+	if query.CalendarURL != "" {
+		u, err := directCalendarURL(query.CalendarURL)
+		if err != nil {
+			return "", err
+		}
+
+		blobs, err := reportCalendarQuery(ctx, newCalDAVClient(query), u, query.AppleId, query.Password, query.Start, query.End)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d calendar objects in range at %s", len(blobs), u), nil
+	}
+
+	calendars, err := discoverCalendars(ctx, newCalDAVClient(query), query)
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	for _, c := range calendars {
+		names = append(names, c.DisplayName)
+	}
+
+	var missing []string
+	for _, name := range query.Calendars {
+		found := false
+		for _, n := range names {
+			if strings.EqualFold(n, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("calendars not found: %s (available: %s)", strings.Join(missing, ", "), strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("%d calendars found", len(calendars)), nil
+}
+
+// checkWritable returns an error if no file can be created in dir.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	return errors.Join(f.Close(), os.Remove(name))
+}
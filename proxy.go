@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var httpProxy = flag.String("http-proxy", "", "Proxy URL for plain HTTP requests to ASPSMS and the CalDav server (overrides HTTP_PROXY)")
+var httpsProxy = flag.String("https-proxy", "", "Proxy URL for HTTPS requests to ASPSMS and the CalDav server (overrides HTTPS_PROXY)")
+
+// proxyFunc returns the function which selects the proxy of a request.
+// Requests for which no proxy URL is set use the proxy configured by
+// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func proxyFunc(httpURL, httpsURL string) (func(*http.Request) (*url.URL, error), error) {
+	httpProxy, err := parseProxyURL(httpURL)
+	if err != nil {
+		return nil, fmt.Errorf("-http-proxy: %w", err)
+	}
+	httpsProxy, err := parseProxyURL(httpsURL)
+	if err != nil {
+		return nil, fmt.Errorf("-https-proxy: %w", err)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		switch {
+		case req.URL.Scheme == "http" && httpProxy != nil:
+			return httpProxy, nil
+		case req.URL.Scheme == "https" && httpsProxy != nil:
+			return httpsProxy, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}, nil
+}
+
+// parseProxyURL parses a proxy URL. Like in HTTP_PROXY,
+// the scheme defaults to http. An empty string returns nil.
+func parseProxyURL(s string) (*url.URL, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in %q", s)
+	}
+	return u, nil
+}
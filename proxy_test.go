@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyFunc(t *testing.T) {
+	proxy, err := proxyFunc("proxy.example.com:3128", "https://secure.example.com:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"http://caldav.example.com/":     "http://proxy.example.com:3128",
+		"https://webapi.aspsms.com/Send": "https://secure.example.com:8443",
+	}
+	for in, want := range tests {
+		req, err := http.NewRequest(http.MethodGet, in, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u == nil || u.String() != want {
+			t.Fatalf("%s: %v != %s", in, u, want)
+		}
+	}
+
+	for _, in := range []string{"ftp://proxy.example.com", "http://"} {
+		if _, err := proxyFunc(in, ""); err == nil {
+			t.Fatalf("%q: expected error", in)
+		}
+	}
+}
+
+func TestCalDAVClientProxy(t *testing.T) {
+	var host string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer srv.Close()
+
+	proxy, err := proxyFunc(srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := newCalDAVClient(Query{Proxy: proxy}).Get("http://caldav.invalid/calendars/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if host != "caldav.invalid" {
+		t.Fatalf("request to %q not sent through the proxy", host)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+var quietStart = flag.String("quiet-start", "", "Start of the quiet hours (HH:MM in -timezone) during which no SMS is delivered (requires -quiet-end).")
+var quietEnd = flag.String("quiet-end", "", "End of the quiet hours (HH:MM in -timezone).")
+var quietBehavior = flag.String("quiet-behavior", "defer", `What to do with reminders during quiet hours: "defer" delivers them at -quiet-end, "skip" leaves them to a later run`)
+
+// quietHours is a time span of a day during which no SMS is delivered.
+// The span wraps around midnight if End is before Start (e.g. 21:00–07:00).
+type quietHours struct {
+	Start clock
+	End   clock
+	// Skip leaves reminders during the quiet hours to a later run
+	// instead of deferring them to End (-quiet-behavior skip).
+	Skip bool
+}
+
+// parseQuietHours parses the quiet hours from start and end.
+// It returns nil if both are empty.
+func parseQuietHours(start, end, behavior string) (*quietHours, error) {
+	if start == "" && end == "" {
+		return nil, nil
+	}
+	if start == "" || end == "" {
+		return nil, errors.New("-quiet-start and -quiet-end must be used together")
+	}
+
+	switch behavior {
+	case "defer", "skip":
+	default:
+		return nil, fmt.Errorf("invalid -quiet-behavior %q (defer or skip)", behavior)
+	}
+
+	s, err := parseClock(start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -quiet-start: %w", err)
+	}
+	e, err := parseClock(end)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -quiet-end: %w", err)
+	}
+	if *s == *e {
+		return nil, errors.New("-quiet-start and -quiet-end must differ")
+	}
+
+	return &quietHours{Start: *s, End: *e, Skip: behavior == "skip"}, nil
+}
+
+// contains returns true if the wall-clock time of t is within the quiet hours.
+func (q quietHours) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	start := q.Start.Hour*60 + q.Start.Minute
+	end := q.End.Hour*60 + q.End.Minute
+	if start < end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// next returns the first time at or after t which is not within the quiet hours.
+func (q quietHours) next(t time.Time) time.Time {
+	if !q.contains(t) {
+		return t
+	}
+
+	end := time.Date(t.Year(), t.Month(), t.Day(), q.End.Hour, q.End.Minute, 0, 0, t.Location())
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
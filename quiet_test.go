@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHours(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Vienna")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := parseQuietHours("21:00", "07:30", "defer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at   time.Time
+		want time.Time
+	}{
+		{time.Date(2025, 1, 10, 12, 0, 0, 0, loc), time.Date(2025, 1, 10, 12, 0, 0, 0, loc)},
+		{time.Date(2025, 1, 10, 21, 0, 0, 0, loc), time.Date(2025, 1, 11, 7, 30, 0, 0, loc)},
+		{time.Date(2025, 1, 10, 3, 15, 0, 0, loc), time.Date(2025, 1, 10, 7, 30, 0, 0, loc)},
+		{time.Date(2025, 1, 10, 7, 30, 0, 0, loc), time.Date(2025, 1, 10, 7, 30, 0, 0, loc)},
+	}
+
+	for _, test := range tests {
+		if is := q.next(test.at); !is.Equal(test.want) {
+			t.Fatalf("%s: %s != %s", test.at, is, test.want)
+		}
+	}
+
+	day, err := parseQuietHours("12:00", "13:00", "skip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !day.contains(time.Date(2025, 1, 10, 12, 30, 0, 0, loc)) || day.contains(time.Date(2025, 1, 10, 21, 0, 0, 0, loc)) {
+		t.Fatal("unexpected quiet hours within a day")
+	}
+}
+
+func TestParseQuietHoursInvalid(t *testing.T) {
+	tests := [][3]string{
+		{"21:00", "", "defer"},
+		{"21:00", "07:00", "later"},
+		{"9pm", "07:00", "defer"},
+		{"07:00", "07:00", "defer"},
+	}
+
+	for _, test := range tests {
+		if _, err := parseQuietHours(test[0], test[1], test[2]); err == nil {
+			t.Fatalf("%v: expected error", test)
+		}
+	}
+
+	if q, err := parseQuietHours("", "", "defer"); q != nil || err != nil {
+		t.Fatalf("unexpected quiet hours %v %v", q, err)
+	}
+}
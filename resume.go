@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/brutella/smsremind/idempotency"
+)
+
+var resume = flag.Bool("resume", false, "Do not query the calendars of which all reminders were sent by the previous, interrupted run with the same range and -offset. Useful for very large calendars.")
+
+// runCursor is the progress of an interrupted run.
+type runCursor struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Offset int       `json:"offset"`
+
+	// Calendars contains the URLs of the calendars
+	// of which all reminders were sent.
+	Calendars []string `json:"calendars"`
+}
+
+// resumedCalendars returns the URLs of the calendars which were fully
+// processed by an interrupted run with the same range and offset.
+func resumedCalendars(store idempotency.StateStore, start, end time.Time) (map[string]bool, error) {
+	cs, ok := store.(idempotency.CursorStore)
+	if !ok {
+		return nil, nil
+	}
+
+	b, err := cs.GetCursor()
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	var cursor runCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		// A broken cursor only costs the time to query all calendars.
+		slog.Warn("ignoring run cursor", "err", err)
+		return nil, nil
+	}
+
+	if !cursor.Start.Equal(start) || !cursor.End.Equal(end) || cursor.Offset != *offset {
+		return nil, nil
+	}
+
+	out := map[string]bool{}
+	for _, u := range cursor.Calendars {
+		out[u] = true
+	}
+	return out, nil
+}
+
+// saveCursor records the calendars of which all reminders were sent
+// or skipped, in addition to the calendars done, which were not queried
+// by this run. If the run was complete, the cursor is deleted, so that
+// the next run queries all calendars again.
+func saveCursor(store idempotency.StateStore, start, end time.Time, done map[string]bool, reminders []reminder, complete bool) error {
+	cs, ok := store.(idempotency.CursorStore)
+	if !ok {
+		return nil
+	}
+
+	if complete {
+		return cs.SetCursor(nil)
+	}
+
+	calendars := map[string]bool{}
+	for u := range done {
+		calendars[u] = true
+	}
+	for _, r := range reminders {
+		u := r.Event.CalendarURL
+		if u == "" {
+			continue
+		}
+		if _, ok := calendars[u]; !ok {
+			calendars[u] = true
+		}
+		if r.Skip == "" && !store.Exists(eventMessageKey(r.Event)) {
+			calendars[u] = false
+		}
+	}
+
+	cursor := runCursor{Start: start, End: end, Offset: *offset}
+	for u, ok := range calendars {
+		if ok {
+			cursor.Calendars = append(cursor.Calendars, u)
+		}
+	}
+	slices.Sort(cursor.Calendars)
+
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+	return cs.SetCursor(b)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brutella/smsremind/cal"
+	"github.com/brutella/smsremind/idempotency"
+)
+
+func TestResumeCursor(t *testing.T) {
+	start := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+
+	sent := cal.Event{UID: "sent", Start: start, CalendarURL: "https://example.com/a/"}
+	pending := cal.Event{UID: "pending", Start: start, CalendarURL: "https://example.com/b/"}
+	reminders := []reminder{
+		{Event: sent},
+		{Event: pending},
+		{Event: cal.Event{UID: "skipped", CalendarURL: "https://example.com/c/"}, Skip: "skipped-no-number"},
+	}
+
+	store := idempotency.NewMemoryStore()
+	if err := store.Mark(eventMessageKey(sent)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := map[string]bool{"https://example.com/d/": true}
+	if err := saveCursor(store, start, end, done, reminders, false); err != nil {
+		t.Fatal(err)
+	}
+
+	calendars, err := resumedCalendars(store, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendars) != 3 || !calendars["https://example.com/a/"] || !calendars["https://example.com/c/"] || !calendars["https://example.com/d/"] {
+		t.Fatalf("unexpected calendars %v", calendars)
+	}
+
+	// Another range starts over.
+	if calendars, _ := resumedCalendars(store, end, end.AddDate(0, 0, 1)); len(calendars) != 0 {
+		t.Fatalf("unexpected calendars %v", calendars)
+	}
+
+	// A complete run deletes the cursor.
+	if err := saveCursor(store, start, end, nil, reminders, true); err != nil {
+		t.Fatal(err)
+	}
+	if calendars, _ := resumedCalendars(store, start, end); len(calendars) != 0 {
+		t.Fatalf("unexpected calendars %v", calendars)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brutella/smsremind/idempotency"
+)
+
+var listState = flag.Bool("list-state", false, "Print the sent reminders in -state-dir grouped by event UID and offset, then exit.")
+
+// stateKey is a parsed key of a sent reminder.
+type stateKey struct {
+	UID     string
+	Start   string
+	Offset  string
+	Version string
+}
+
+// parseStateKey parses a key in the format of eventMessageKey.
+// The key is parsed from the end, because UIDs may contain "|".
+func parseStateKey(key string) (stateKey, bool) {
+	parts := strings.Split(key, "|")
+
+	var k stateKey
+	if n := len(parts); n > 0 && strings.HasPrefix(parts[n-1], "v-") {
+		k.Version = strings.TrimPrefix(parts[n-1], "v-")
+		parts = parts[:n-1]
+	}
+
+	n := len(parts)
+	if n < 3 {
+		return stateKey{}, false
+	}
+
+	k.UID = strings.Join(parts[:n-2], "|")
+	k.Start = parts[n-2]
+	k.Offset = parts[n-1]
+	if k.UID == "" || !strings.HasPrefix(k.Offset, "T-") {
+		return stateKey{}, false
+	}
+	if _, err := time.Parse(time.RFC3339, k.Start); err != nil {
+		return stateKey{}, false
+	}
+	return k, true
+}
+
+// printState writes the keys of store grouped by UID and offset to w.
+// Keys which are not in the format of eventMessageKey are listed last.
+func printState(w io.Writer, store idempotency.StateStore) error {
+	keys, err := store.Keys()
+	if err != nil {
+		return err
+	}
+
+	groups := map[string]map[string][]stateKey{}
+	var other []string
+	for _, key := range keys {
+		k, ok := parseStateKey(key)
+		if !ok {
+			other = append(other, key)
+			continue
+		}
+		if groups[k.UID] == nil {
+			groups[k.UID] = map[string][]stateKey{}
+		}
+		groups[k.UID][k.Offset] = append(groups[k.UID][k.Offset], k)
+	}
+
+	for _, uid := range slices.Sorted(maps.Keys(groups)) {
+		fmt.Fprintln(w, uid)
+		for _, offset := range slices.Sorted(maps.Keys(groups[uid])) {
+			keys := groups[uid][offset]
+			sort.Slice(keys, func(i, j int) bool {
+				if keys[i].Start != keys[j].Start {
+					return keys[i].Start < keys[j].Start
+				}
+				return keys[i].Version < keys[j].Version
+			})
+
+			fmt.Fprintf(w, "  %s\n", offset)
+			for _, k := range keys {
+				line := "    " + k.Start
+				if k.Version != "" {
+					line += " v-" + k.Version
+				}
+				if at, ok := store.MarkedAt(k.key()); ok {
+					line += " sent " + at.Format(time.RFC3339)
+				}
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+
+	if len(other) > 0 {
+		sort.Strings(other)
+		fmt.Fprintln(w, "other")
+		for _, key := range other {
+			fmt.Fprintf(w, "  %s\n", key)
+		}
+	}
+	return nil
+}
+
+// key returns the key in the format of eventMessageKey.
+func (k stateKey) key() string {
+	key := k.UID + "|" + k.Start + "|" + k.Offset
+	if k.Version != "" {
+		key += "|v-" + k.Version
+	}
+	return key
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/brutella/smsremind/idempotency"
+)
+
+func TestParseStateKey(t *testing.T) {
+	tests := map[string]stateKey{
+		"abc|2025-01-10T09:30:00+01:00|T-1d":     {UID: "abc", Start: "2025-01-10T09:30:00+01:00", Offset: "T-1d"},
+		"abc|2025-01-10T09:30:00+01:00|T-1d|v-2": {UID: "abc", Start: "2025-01-10T09:30:00+01:00", Offset: "T-1d", Version: "2"},
+		"a|b|2025-01-10T09:30:00Z|T-0d":          {UID: "a|b", Start: "2025-01-10T09:30:00Z", Offset: "T-0d"},
+	}
+
+	for key, want := range tests {
+		is, ok := parseStateKey(key)
+		if !ok || is != want {
+			t.Fatalf("%q: %+v != %+v", key, is, want)
+		}
+		if is.key() != key {
+			t.Fatalf("%q != %q", is.key(), key)
+		}
+	}
+
+	for _, key := range []string{"", "abc", "abc|T-1d", "abc|tomorrow|T-1d", "|2025-01-10T09:30:00Z|T-1d"} {
+		if _, ok := parseStateKey(key); ok {
+			t.Fatalf("%q: expected invalid key", key)
+		}
+	}
+}
+
+func TestPrintState(t *testing.T) {
+	store := idempotency.NewMemoryStore()
+	for _, key := range []string{
+		"b|2025-01-10T09:30:00+01:00|T-1d",
+		"a|2025-01-11T09:30:00+01:00|T-1d",
+		"a|2025-01-10T09:30:00+01:00|T-1d|v-2",
+		"a|2025-01-10T09:30:00+01:00|T-0d",
+		"legacy",
+	} {
+		if err := store.Mark(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	printState(&buf, store)
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		// Strip the time of sending
+		line, _, _ = strings.Cut(line, " sent ")
+		lines = append(lines, line)
+	}
+
+	want := []string{
+		"a",
+		"  T-0d",
+		"    2025-01-10T09:30:00+01:00",
+		"  T-1d",
+		"    2025-01-10T09:30:00+01:00 v-2",
+		"    2025-01-11T09:30:00+01:00",
+		"b",
+		"  T-1d",
+		"    2025-01-10T09:30:00+01:00",
+		"other",
+		"  legacy",
+	}
+	if is, want := strings.Join(lines, "\n"), strings.Join(want, "\n"); is != want {
+		t.Fatalf("\n%s\n!=\n%s", is, want)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brutella/smsremind/aspsms"
+	"github.com/brutella/smsremind/idempotency"
+)
+
+var status = flag.Bool("status", false, `Print the reachability of the CalDav server, the ASPSMS credits, the number of sent reminders in -state-dir and the time of the last successful run, then exit without sending. Use -output json for monitoring.`)
+
+// statusCheck is the result of a check of -status.
+type statusCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func newStatusCheck(err error) statusCheck {
+	if err != nil {
+		return statusCheck{Error: err.Error()}
+	}
+	return statusCheck{OK: true}
+}
+
+// statusReport is the output of -status.
+type statusReport struct {
+	CalDAV statusCheck `json:"caldav"`
+
+	Accounts []accountStatus `json:"aspsms_accounts"`
+
+	Store struct {
+		statusCheck
+		Entries int `json:"entries"`
+	} `json:"store"`
+
+	LastSuccess struct {
+		statusCheck
+		Time       *time.Time `json:"time,omitempty"`
+		AgeSeconds int64      `json:"age_seconds,omitempty"`
+	} `json:"last_success"`
+}
+
+type accountStatus struct {
+	statusCheck
+	Credits float64 `json:"credits"`
+}
+
+// statusConfig contains the dependencies of collectStatus.
+type statusConfig struct {
+	Queries  []Query
+	Accounts aspsms.Failover
+	Store    func() (idempotency.StateStore, error)
+
+	// LastSuccess is the path of the file written by recordSuccess.
+	LastSuccess string
+	Now         time.Time
+}
+
+// collectStatus runs the read-only checks of -status.
+func collectStatus(ctx context.Context, cfg statusConfig) statusReport {
+	var report statusReport
+
+	var errs []error
+	for i, query := range cfg.Queries {
+		if err := checkPrincipal(ctx, query); err != nil {
+			if len(cfg.Queries) > 1 {
+				err = fmt.Errorf("account %d: %w", i+1, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	report.CalDAV = newStatusCheck(errors.Join(errs...))
+
+	report.Accounts = []accountStatus{}
+	for _, c := range cfg.Accounts {
+		credits, err := c.Credits()
+		report.Accounts = append(report.Accounts, accountStatus{newStatusCheck(err), credits})
+	}
+
+	store, err := cfg.Store()
+	if err == nil {
+		var keys []string
+		keys, err = store.Keys()
+		report.Store.Entries = len(keys)
+		err = errors.Join(err, store.Close())
+	}
+	report.Store.statusCheck = newStatusCheck(err)
+
+	last, err := readLastSuccess(cfg.LastSuccess)
+	if err == nil && last.IsZero() {
+		err = errors.New("no successful run")
+	}
+	report.LastSuccess.statusCheck = newStatusCheck(err)
+	if !last.IsZero() {
+		report.LastSuccess.Time = &last
+		report.LastSuccess.AgeSeconds = int64(cfg.Now.Sub(last).Seconds())
+	}
+	return report
+}
+
+// checkPrincipal returns an error if the current-user-principal of the
+// CalDav server can't be discovered.
+func checkPrincipal(ctx context.Context, query Query) error {
+	u, err := url.Parse(query.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	if _, err := propfindCurrentUserPrincipal(ctx, newCalDAVClient(query), u, query.AppleId, query.Password); err != nil {
+		return fmt.Errorf("current-user-principal: %w", err)
+	}
+	return nil
+}
+
+// failed returns the names of the failed checks.
+func (r statusReport) failed() []string {
+	var out []string
+	if !r.CalDAV.OK {
+		out = append(out, "caldav")
+	}
+	for i, a := range r.Accounts {
+		if !a.OK {
+			out = append(out, fmt.Sprintf("aspsms account %d", i+1))
+		}
+	}
+	if !r.Store.OK {
+		out = append(out, "store")
+	}
+	if !r.LastSuccess.OK {
+		out = append(out, "last success")
+	}
+	return out
+}
+
+// writeStatus writes the report to w as text or as JSON (format "json").
+func writeStatus(w io.Writer, r statusReport, format string) error {
+	if format == "json" {
+		return json.NewEncoder(w).Encode(r)
+	}
+
+	line := func(name string, c statusCheck, result string) {
+		if !c.OK {
+			fmt.Fprintf(w, "FAIL %s: %s\n", name, c.Error)
+			return
+		}
+		fmt.Fprintf(w, "ok   %s: %s\n", name, result)
+	}
+
+	line("caldav", r.CalDAV, "principal discovered")
+	for i, a := range r.Accounts {
+		line(fmt.Sprintf("aspsms account %d", i+1), a.statusCheck, fmt.Sprintf("%.2f credits", a.Credits))
+	}
+	line("store", r.Store.statusCheck, fmt.Sprintf("%d entries", r.Store.Entries))
+
+	if r.LastSuccess.Time != nil {
+		age := time.Duration(r.LastSuccess.AgeSeconds) * time.Second
+		line("last success", r.LastSuccess.statusCheck, fmt.Sprintf("%s (%s ago)", r.LastSuccess.Time.Format(time.RFC3339), age))
+	} else {
+		line("last success", r.LastSuccess.statusCheck, "")
+	}
+	return nil
+}
+
+// runStatus prints the status and returns an error if any check failed.
+// The exit code of the error is exitCalDAV if the CalDav check failed,
+// exitASPSMS if an ASPSMS account failed and exitFailure otherwise.
+func runStatus(ctx context.Context, cfg statusConfig) error {
+	report := collectStatus(ctx, cfg)
+	if err := writeStatus(os.Stdout, report, *output); err != nil {
+		return err
+	}
+
+	failed := report.failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	code := exitFailure
+	if !report.CalDAV.OK {
+		code = exitCalDAV
+	} else if slices.ContainsFunc(report.Accounts, func(a accountStatus) bool { return !a.OK }) {
+		code = exitASPSMS
+	}
+	return withExitCode(code, fmt.Errorf("status: %s failed", strings.Join(failed, ", ")))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brutella/smsremind/idempotency"
+)
+
+func TestStatus(t *testing.T) {
+	srv := newCalDAVServer(t)
+	path := filepath.Join(t.TempDir(), "lastsuccess.json")
+	now := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	store := idempotency.NewMemoryStore()
+	if err := store.Mark("a"); err != nil {
+		t.Fatal(err)
+	}
+	cfg := statusConfig{
+		Queries:     []Query{testQuery(srv.URL + "/")},
+		Store:       func() (idempotency.StateStore, error) { return store, nil },
+		LastSuccess: path,
+		Now:         now,
+	}
+
+	report := collectStatus(context.Background(), cfg)
+	if is, want := strings.Join(report.failed(), ","), "last success"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+	if report.Store.Entries != 1 {
+		t.Fatalf("%d entries, want 1", report.Store.Entries)
+	}
+
+	if err := recordSuccess(path, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Queries = append(cfg.Queries, testQuery("http://127.0.0.1:0/"))
+
+	report = collectStatus(context.Background(), cfg)
+	if is, want := strings.Join(report.failed(), ","), "caldav"; is != want {
+		t.Fatalf("%q != %q", is, want)
+	}
+
+	var buf bytes.Buffer
+	if err := writeStatus(&buf, report, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	var v struct {
+		LastSuccess struct {
+			OK         bool  `json:"ok"`
+			AgeSeconds int64 `json:"age_seconds"`
+		} `json:"last_success"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !v.LastSuccess.OK || v.LastSuccess.AgeSeconds != 3600 {
+		t.Fatalf("unexpected last success %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeStatus(&buf, report, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "FAIL caldav: account 2: ") || !strings.Contains(buf.String(), "ok   last success: 2025-01-10T08:00:00Z (1h0m0s ago)") {
+		t.Fatalf("unexpected output\n%s", buf.String())
+	}
+}
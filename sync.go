@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// syncChange is a resource which changed since the last sync.
+type syncChange struct {
+	Href    string
+	ETag    string
+	Deleted bool
+}
+
+// maxSyncRequests limits the number of requests of a truncated sync (507 Insufficient Storage).
+const maxSyncRequests = 10
+
+// reportSyncCollection returns the resources of the calendar which changed
+// since the sync token (RFC 6578) together with the new token.
+// An empty token returns all resources of the calendar.
+func reportSyncCollection(ctx context.Context, c *http.Client, calURL *url.URL, user, pass string, token string) ([]syncChange, string, error) {
+	var changes []syncChange
+	for i := 0; i < maxSyncRequests; i++ {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(token))
+
+		body := []byte(fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<d:sync-collection xmlns:d="DAV:">
+  <d:sync-token>%s</d:sync-token>
+  <d:sync-level>1</d:sync-level>
+  <d:prop>
+    <d:getetag/>
+  </d:prop>
+</d:sync-collection>`, buf.String()))
+
+		b, _, _, err := doDAV(ctx, c, "REPORT", calURL, user, pass, "0", body)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w\n%s", err, string(b))
+		}
+
+		page, next, truncated, err := parseSyncCollection(b, calURL)
+		if err != nil {
+			return nil, "", err
+		}
+		if next == "" {
+			return nil, "", fmt.Errorf("sync-collection: missing sync-token")
+		}
+
+		changes = append(changes, page...)
+		token = next
+		if !truncated {
+			return changes, token, nil
+		}
+	}
+	return nil, "", fmt.Errorf("sync-collection: still truncated after %d requests", maxSyncRequests)
+}
+
+// parseSyncCollection parses the multistatus response of a sync-collection REPORT.
+// truncated is true if the server reported more changes with 507 on the collection.
+func parseSyncCollection(b []byte, calURL *url.URL) (changes []syncChange, token string, truncated bool, err error) {
+	type syncMS struct {
+		SyncToken string `xml:"sync-token"`
+		Responses []struct {
+			Href      string `xml:"href"`
+			Status    string `xml:"status"`
+			Propstats []struct {
+				Prop struct {
+					ETag string `xml:"getetag"`
+				} `xml:"prop"`
+			} `xml:"propstat"`
+		} `xml:"response"`
+	}
+	var ms syncMS
+	if err := xml.Unmarshal(b, &ms); err != nil {
+		return nil, "", false, err
+	}
+
+	for _, r := range ms.Responses {
+		href := strings.TrimSpace(r.Href)
+		if resolveHref(calURL, href).Path == calURL.Path {
+			truncated = truncated || strings.Contains(r.Status, " 507")
+			continue
+		}
+
+		change := syncChange{Href: href, Deleted: strings.Contains(r.Status, " 404")}
+		for _, ps := range r.Propstats {
+			if etag := strings.TrimSpace(ps.Prop.ETag); etag != "" {
+				change.ETag = etag
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, strings.TrimSpace(ms.SyncToken), truncated, nil
+}
+
+// syncCalendarData returns the calendar data of all resources of the calendar.
+// The cache is updated with the changes since the last sync.
+func syncCalendarData(ctx context.Context, c *http.Client, query Query, calURL *url.URL) ([]string, error) {
+	cache := query.Cache
+	changes, token, err := reportSyncCollection(ctx, c, calURL, query.AppleId, query.Password, cache.Token(calURL.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, ch := range changes {
+		href := resolveHref(calURL, ch.Href).String()
+		switch {
+		case ch.Deleted:
+			cache.Delete(href)
+		case ch.ETag == "" || !cache.Has(href, ch.ETag):
+			changed = append(changed, ch.Href)
+		}
+	}
+
+	if len(changed) > 0 {
+		fetched, err := multigetCalendarResources(ctx, c, calURL, query.AppleId, query.Password, changed)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range fetched {
+			if r.Data != "" {
+				cache.Put(resolveHref(calURL, r.Href).String(), r.ETag, r.Data)
+			}
+		}
+	}
+
+	cache.SetToken(calURL.String(), token)
+	return cache.Collection(calURL.String()), nil
+}
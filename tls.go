@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+var clientCert = flag.String("client-cert", "", "PEM file with a client certificate for CalDav servers which require mutual TLS (requires -client-key)")
+var clientKey = flag.String("client-key", "", "PEM file with the private key of -client-cert")
+var insecure = flag.Bool("insecure", false, "Do not verify the TLS certificate of the CalDav server. Only for testing!")
+var caCert = flag.String("ca-cert", "", "PEM file with the CA certificates which are trusted for the CalDav server instead of the system CAs")
+
+// caldavTLSConfig returns the TLS configuration for the CalDav server
+// or nil if the default configuration is used.
+func caldavTLSConfig() (*tls.Config, error) {
+	if *clientCert == "" && *clientKey == "" && *caCert == "" && !*insecure {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if *insecure {
+		// Reported on every run, so that it isn't left on by accident.
+		// It is written to stderr directly, so that -log-level error
+		// doesn't hide it.
+		fmt.Fprintln(os.Stderr, "INSECURE: the TLS certificate of the CalDav server is not verified (-insecure)")
+		cfg.InsecureSkipVerify = true
+	}
+
+	if (*clientCert == "") != (*clientKey == "") {
+		return nil, errors.New("-client-cert and -client-key must be used together")
+	}
+	if *clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if *caCert != "" {
+		b, err := os.ReadFile(*caCert)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("%s: no PEM certificates", *caCert)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
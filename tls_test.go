@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to dir.
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestCalDAVClientCertificate(t *testing.T) {
+	defer func(cert, key, ca string) {
+		*clientCert, *clientKey, *caCert = cert, key, ca
+	}(*clientCert, *clientKey, *caCert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	*caCert = filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(*caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The CA is trusted, but the server requires a client certificate
+	cfg, err := caldavTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newCalDAVClient(Query{TLS: cfg}).Get(srv.URL); err == nil {
+		t.Fatal("expected error without client certificate")
+	}
+
+	*clientCert, *clientKey = writeClientCert(t, dir)
+	cfg, err = caldavTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := newCalDAVClient(Query{TLS: cfg}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	*clientKey = ""
+	if _, err := caldavTLSConfig(); err == nil {
+		t.Fatal("expected error for certificate without key")
+	}
+}
+
+func TestCalDAVInsecure(t *testing.T) {
+	defer func(v bool) { *insecure = v }(*insecure)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	if _, err := newCalDAVClient(Query{}).Get(srv.URL); err == nil {
+		t.Fatal("expected error for self-signed certificate")
+	}
+
+	*insecure = true
+	cfg, err := caldavTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := newCalDAVClient(Query{TLS: cfg}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}